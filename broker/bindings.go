@@ -0,0 +1,93 @@
+package broker
+
+import (
+	log "github.com/alecthomas/log4go"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+//Binder adds routing keys to a running consumer, implemented by the
+//icsoclib consumer
+type Binder interface {
+	AppendBinding(key ...string) error
+}
+
+//Bindings adds the routing keys of rules changed at runtime to a
+//consumer. The icsoclib consumer refuses keys before its channel is
+//open, those are kept and tried again by Run. A key failing on an open
+//or closed channel is already kept by the consumer and bound when it
+//reconnects.
+type Bindings struct {
+	b       Binder
+	lock    sync.Mutex
+	bound   map[string]bool
+	pending []string
+}
+
+//NewBindings returns the bindings of b, bound are the keys b was
+//created with
+func NewBindings(b Binder, bound []string) *Bindings {
+	s := &Bindings{b: b, bound: make(map[string]bool, len(bound))}
+	for _, k := range bound {
+		s.bound[k] = true
+	}
+	return s
+}
+
+//Add binds the keys not bound yet
+func (s *Bindings) Add(keys ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, k := range keys {
+		if s.bound[k] {
+			continue
+		}
+		s.bound[k] = true
+		s.pending = append(s.pending, k)
+	}
+	s.flush()
+}
+
+//Pending returns the keys waiting for the consumer to connect
+func (s *Bindings) Pending() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.pending...)
+}
+
+//flush tries the pending keys, called with lock held
+func (s *Bindings) flush() {
+	var left []string
+	for _, k := range s.pending {
+		err := s.b.AppendBinding(k)
+		if err == nil {
+			log.Info("bound %s", k)
+			continue
+		}
+		if _, ok := err.(*amqp.Error); ok {
+			log.Warn("bind %s, %s, bound on reconnect", k, err.Error())
+			continue
+		}
+		left = append(left, k)
+	}
+	s.pending = left
+}
+
+//Run tries the pending keys every interval until done is closed
+func (s *Bindings) Run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.lock.Lock()
+			if len(s.pending) > 0 {
+				s.flush()
+			}
+			s.lock.Unlock()
+		case <-done:
+			return
+		}
+	}
+}
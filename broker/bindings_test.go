@@ -0,0 +1,45 @@
+package broker
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeBinder struct {
+	err  error
+	keys []string
+}
+
+func (f *fakeBinder) AppendBinding(key ...string) error {
+	if f.err == nil {
+		f.keys = append(f.keys, key...)
+	}
+	return f.err
+}
+
+func TestBindings(t *testing.T) {
+	f := &fakeBinder{err: errors.New("channel closed")}
+	s := NewBindings(f, []string{"a"})
+
+	//not connected yet, kept
+	s.Add("a", "b")
+	assert.Equal(t, []string{"b"}, s.Pending())
+	s.Add("b", "c")
+	assert.Equal(t, []string{"b", "c"}, s.Pending())
+
+	//connected
+	f.err = nil
+	done := make(chan struct{})
+	time.AfterFunc(20*time.Millisecond, func() { close(done) })
+	s.Run(time.Millisecond, done)
+	assert.Empty(t, s.Pending())
+	assert.Equal(t, []string{"b", "c"}, f.keys)
+
+	//lost connection, the consumer binds it on reconnect
+	f.err = amqp.ErrClosed
+	s.Add("d")
+	assert.Empty(t, s.Pending())
+}
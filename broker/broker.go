@@ -0,0 +1,167 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+//headers of republished deliveries
+const (
+	HeaderAttempt    = "x-sx-attempt"     //retries so far
+	HeaderRoutingKey = "x-sx-routing-key" //routing key of the original delivery
+	HeaderReason     = "x-sx-reason"      //why it was republished
+	HeaderError      = "x-sx-error"       //error of a dead lettered delivery
+	HeaderTime       = "x-sx-time"        //unix seconds it was republished
+)
+
+//confirmTimeout bounds the wait for the broker to confirm a publish
+var confirmTimeout = 5 * time.Second
+
+var errConfirmTimeout = errors.New("publish confirm timeout")
+
+//Sender publishes one message, implemented by Publisher
+type Sender interface {
+	Publish(exchange, key string, msg amqp.Publishing) error
+}
+
+//Publisher publishes persistent messages and waits for the broker to
+//confirm each. Unlike the icsoclib producer it keeps headers. It
+//connects on first use and again after the connection is lost, declare
+//runs on every connect.
+type Publisher struct {
+	url     string
+	declare func(ch *amqp.Channel) error
+
+	lock    sync.Mutex
+	conn    *amqp.Connection
+	ch      *amqp.Channel
+	closed  chan *amqp.Error
+	confirm chan amqp.Confirmation
+}
+
+//NewPublisher creates a publisher, declare may be nil
+func NewPublisher(url string, declare func(ch *amqp.Channel) error) *Publisher {
+	return &Publisher{url: url, declare: declare}
+}
+
+//Publish sends msg persistently and returns once the broker confirmed it
+func (p *Publisher) Publish(exchange, key string, msg amqp.Publishing) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := p.connect(); err != nil {
+		return err
+	}
+	msg.DeliveryMode = amqp.Persistent
+	if err := p.ch.Publish(exchange, key, false, false, msg); err != nil {
+		p.close()
+		return err
+	}
+	select {
+	case c, ok := <-p.confirm:
+		if !ok {
+			p.close()
+			return amqp.ErrClosed
+		}
+		if !c.Ack {
+			return fmt.Errorf("publish exchange:%s key:%s nacked", exchange, key)
+		}
+		return nil
+	case <-time.After(confirmTimeout):
+		//a late confirm would be taken for the next publish
+		p.close()
+		return errConfirmTimeout
+	}
+}
+
+//Close closes the connection, a later Publish reconnects
+func (p *Publisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.close()
+	return nil
+}
+
+func (p *Publisher) connect() error {
+	if p.conn != nil {
+		select {
+		case <-p.closed:
+			p.close()
+		default:
+			return nil
+		}
+	}
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if p.declare != nil {
+		if err = p.declare(ch); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if err = ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn, p.ch = conn, ch
+	p.closed = conn.NotifyClose(make(chan *amqp.Error, 1))
+	p.confirm = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+func (p *Publisher) close() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.ch = nil, nil
+}
+
+//RoutingKey returns the routing key d was first published with,
+//republished deliveries carry it in a header
+func RoutingKey(d *amqp.Delivery) string {
+	if k, ok := d.Headers[HeaderRoutingKey].(string); ok && len(k) > 0 {
+		return k
+	}
+	return d.RoutingKey
+}
+
+//Attempt returns the retries of d so far
+func Attempt(d *amqp.Delivery) int {
+	switch v := d.Headers[HeaderAttempt].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+//republish copies d for publishing again with extra headers
+func republish(d *amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	h := make(amqp.Table, len(d.Headers)+len(headers)+1)
+	for k, v := range d.Headers {
+		h[k] = v
+	}
+	h[HeaderRoutingKey] = RoutingKey(d)
+	for k, v := range headers {
+		h[k] = v
+	}
+	return amqp.Publishing{
+		Headers:     h,
+		ContentType: d.ContentType,
+		MessageId:   d.MessageId,
+		Timestamp:   d.Timestamp,
+		Body:        d.Body,
+	}
+}
@@ -0,0 +1,33 @@
+package broker
+
+import (
+	"github.com/streadway/amqp"
+	"time"
+)
+
+//DeadLetter keeps deliveries that can't be handled, ie: payloads msgproxy
+//changed, in Queue through the fanout Exchange
+type DeadLetter struct {
+	Exchange string
+	Queue    string
+}
+
+//Declare declares the exchange and the queue bound to it
+func (dl *DeadLetter) Declare(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(dl.Exchange, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(dl.Queue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(dl.Queue, "", dl.Exchange, false, nil)
+}
+
+//Publish dead letters d with the reason code and the error
+func (dl *DeadLetter) Publish(s Sender, d *amqp.Delivery, reason, detail string) error {
+	return s.Publish(dl.Exchange, RoutingKey(d), republish(d, amqp.Table{
+		HeaderReason: reason,
+		HeaderError:  detail,
+		HeaderTime:   time.Now().Unix(),
+	}))
+}
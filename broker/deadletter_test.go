@@ -0,0 +1,22 @@
+package broker
+
+import (
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDeadLetter(t *testing.T) {
+	dl := &DeadLetter{Exchange: "q.dlx", Queue: "q.dlq"}
+	var s fakeSender
+	d := &amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte("{")}
+	assert.NoError(t, dl.Publish(&s, d, "bad_payload", "unexpected end of JSON input"))
+	assert.Equal(t, "q.dlx", s[0].exchange)
+	assert.Equal(t, "msgproxy.1.21", s[0].key)
+	assert.Equal(t, []byte("{"), s[0].msg.Body)
+	assert.Equal(t, "bad_payload", s[0].msg.Headers[HeaderReason])
+	assert.Equal(t, "unexpected end of JSON input", s[0].msg.Headers[HeaderError])
+	assert.Equal(t, "msgproxy.1.21", s[0].msg.Headers[HeaderRoutingKey])
+	assert.InDelta(t, time.Now().Unix(), s[0].msg.Headers[HeaderTime], 5)
+}
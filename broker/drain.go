@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"github.com/streadway/amqp"
+)
+
+//Drain feeds the messages of queue to f and acks those f handled. It
+//stops after the messages queued when it started, so a message f sends
+//back to queue isn't seen twice, and at the first error of f, leaving
+//that message queued.
+func Drain(url, queue string, f func(d *amqp.Delivery) error) (int, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for ; n < q.Messages; n++ {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			break
+		}
+		if err = f(&d); err != nil {
+			d.Nack(false, true)
+			return n, err
+		}
+		if err = d.Ack(false); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
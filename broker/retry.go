@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"github.com/streadway/amqp"
+	"time"
+)
+
+//Retry delays failed deliveries of Queue. A failed delivery is published
+//to a delay queue named after its delay, the delay queue holds it for
+//its ttl and then dead letters it to Exchange, which routes it back to
+//Queue. The delay doubles on each attempt up to MaxDelay, a delivery
+//failing Max times is parked in Parking for inspection and replay.
+type Retry struct {
+	Queue    string
+	Exchange string
+	Parking  string
+	Max      int
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+//TTL returns the delay before retry attempt, counted from 1
+func (r *Retry) TTL(attempt int) time.Duration {
+	d := r.Delay
+	for i := 1; i < attempt && (r.MaxDelay <= 0 || d < r.MaxDelay); i++ {
+		d *= 2
+	}
+	if r.MaxDelay > 0 && d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	return d
+}
+
+//DelayQueue returns the queue holding deliveries before retry attempt,
+//the ttl is part of the name so changing Delay doesn't clash with
+//queues declared before
+func (r *Retry) DelayQueue(attempt int) string {
+	return r.Queue + ".delay." + r.TTL(attempt).String()
+}
+
+//Declare declares the retry exchange, the delay queues and the parking
+//queue, and binds Queue to the retry exchange
+func (r *Retry) Declare(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(r.Exchange, "direct", true, false, false, false, nil); err != nil {
+		return err
+	}
+	//same arguments as the consumer declares it with
+	if _, err := ch.QueueDeclare(r.Queue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(r.Queue, r.Queue, r.Exchange, false, nil); err != nil {
+		return err
+	}
+	for i := 1; i <= r.Max; i++ {
+		if _, err := ch.QueueDeclare(r.DelayQueue(i), true, false, false, false, amqp.Table{
+			"x-message-ttl":             int32(r.TTL(i) / time.Millisecond),
+			"x-dead-letter-exchange":    r.Exchange,
+			"x-dead-letter-routing-key": r.Queue,
+		}); err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(r.Parking, true, false, false, false, nil)
+	return err
+}
+
+//Republish sends d to the delay queue of its next attempt, or to the
+//parking queue once Max attempts are used up
+func (r *Retry) Republish(s Sender, d *amqp.Delivery, reason string) (attempt int, parked bool, err error) {
+	attempt = Attempt(d) + 1
+	headers := amqp.Table{
+		HeaderReason: reason,
+		HeaderTime:   time.Now().Unix(),
+	}
+	if attempt > r.Max {
+		return attempt - 1, true, s.Publish("", r.Parking, republish(d, headers))
+	}
+	headers[HeaderAttempt] = int32(attempt)
+	return attempt, false, s.Publish("", r.DelayQueue(attempt), republish(d, headers))
+}
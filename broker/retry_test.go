@@ -0,0 +1,75 @@
+package broker
+
+import (
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type published struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+type fakeSender []published
+
+func (f *fakeSender) Publish(exchange, key string, msg amqp.Publishing) error {
+	*f = append(*f, published{exchange, key, msg})
+	return nil
+}
+
+func TestRetryTTL(t *testing.T) {
+	r := &Retry{Queue: "q", Delay: 10 * time.Second, MaxDelay: time.Minute}
+	assert.Equal(t, 10*time.Second, r.TTL(1))
+	assert.Equal(t, 20*time.Second, r.TTL(2))
+	assert.Equal(t, 40*time.Second, r.TTL(3))
+	assert.Equal(t, time.Minute, r.TTL(4))
+	assert.Equal(t, time.Minute, r.TTL(100))
+	assert.Equal(t, "q.delay.10s", r.DelayQueue(1))
+	assert.Equal(t, "q.delay.1m0s", r.DelayQueue(5))
+
+	r.MaxDelay = 0
+	assert.Equal(t, 80*time.Second, r.TTL(4))
+}
+
+func TestRepublish(t *testing.T) {
+	r := &Retry{Queue: "q", Exchange: "q.retry", Parking: "q.parking", Max: 2, Delay: time.Second}
+	var s fakeSender
+	d := &amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte("x"), Headers: amqp.Table{"other": "kept"}}
+
+	attempt, parked, err := r.Republish(&s, d, "timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempt)
+	assert.False(t, parked)
+	assert.Equal(t, "", s[0].exchange)
+	assert.Equal(t, "q.delay.1s", s[0].key)
+	assert.Equal(t, []byte("x"), s[0].msg.Body)
+	assert.Equal(t, "kept", s[0].msg.Headers["other"])
+	assert.Equal(t, "timeout", s[0].msg.Headers[HeaderReason])
+	assert.Equal(t, "msgproxy.1.21", s[0].msg.Headers[HeaderRoutingKey])
+
+	//dead lettered back to q with the delay queue's routing key
+	d = &amqp.Delivery{RoutingKey: "q", Body: s[0].msg.Body, Headers: s[0].msg.Headers}
+	assert.Equal(t, "msgproxy.1.21", RoutingKey(d))
+	assert.Equal(t, 1, Attempt(d))
+	attempt, parked, err = r.Republish(&s, d, "timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempt)
+	assert.Equal(t, "q.delay.2s", s[1].key)
+
+	d = &amqp.Delivery{RoutingKey: "q", Body: s[1].msg.Body, Headers: s[1].msg.Headers}
+	attempt, parked, err = r.Republish(&s, d, "502")
+	assert.NoError(t, err)
+	assert.True(t, parked)
+	assert.Equal(t, 2, attempt)
+	assert.Equal(t, "q.parking", s[2].key)
+	assert.Equal(t, "502", s[2].msg.Headers[HeaderReason])
+	assert.Equal(t, "msgproxy.1.21", s[2].msg.Headers[HeaderRoutingKey])
+}
+
+func TestRoutingKey(t *testing.T) {
+	assert.Equal(t, "a", RoutingKey(&amqp.Delivery{RoutingKey: "a"}))
+	assert.Equal(t, 0, Attempt(&amqp.Delivery{}))
+	assert.Equal(t, 3, Attempt(&amqp.Delivery{Headers: amqp.Table{HeaderAttempt: int64(3)}}))
+}
@@ -0,0 +1,225 @@
+package carrier
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+//Carrier is the operator a mobile number belongs to
+type Carrier int
+
+const (
+	Unknown Carrier = iota
+	Mobile
+	Unicom
+	Telecom
+	Virtual //mobile virtual network operator, see Segment.Host
+)
+
+var names = []string{"unknown", "mobile", "unicom", "telecom", "virtual"}
+
+func (c Carrier) String() string {
+	if c < 0 || int(c) >= len(names) {
+		return names[Unknown]
+	}
+	return names[c]
+}
+
+//Bit returns the carrier bit of a carrier mask, ie: FlashSMS.Vendor,
+//mobile 1, unicom 2, telecom 4, virtual 8
+func (c Carrier) Bit() int {
+	if c <= Unknown || int(c) >= len(names) {
+		return 0
+	}
+	return 1 << uint(c-1)
+}
+
+//AllMask has the bit of every carrier
+const AllMask = 0xf
+
+//ValidMask reports whether mask only has carrier bits
+func ValidMask(mask int) bool {
+	return mask >= 0 && mask&^AllMask == 0
+}
+
+//In reports whether the carrier bit is set in mask
+func (c Carrier) In(mask int) bool {
+	return mask&c.Bit() != 0
+}
+
+//ParseCarrier returns the carrier of name, ie: telecom
+func ParseCarrier(name string) (Carrier, bool) {
+	for i, v := range names {
+		if v == name {
+			return Carrier(i), true
+		}
+	}
+	return Unknown, false
+}
+
+//Segment is the carrier of a number segment, Host is the network a
+//virtual operator rents, Host equals Carrier otherwise
+type Segment struct {
+	Carrier Carrier
+	Host    Carrier
+}
+
+type node struct {
+	next [10]*node
+	seg  *Segment
+}
+
+//Table resolves numbers by the longest matched segment
+type Table struct {
+	root node
+	size int
+}
+
+//Parse reads a segment table, one carrier per line followed by its
+//comma separated segments, a virtual carrier names its host network:
+//  # comment
+//  telecom 133,1349,153
+//  virtual/telecom 1700,1701,1702
+func Parse(r io.Reader) (*Table, error) {
+	t := &Table{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want carrier and segments", line)
+		}
+		seg, err := parseSegment(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		for _, prefix := range strings.Split(fields[1], ",") {
+			if err := t.add(prefix, seg); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseSegment(s string) (*Segment, error) {
+	name, host := s, ""
+	if i := strings.Index(s, "/"); i >= 0 {
+		name, host = s[:i], s[i+1:]
+	}
+	c, ok := ParseCarrier(name)
+	if !ok || c == Unknown {
+		return nil, fmt.Errorf("unknown carrier %s", name)
+	}
+	seg := &Segment{Carrier: c, Host: c}
+	if c == Virtual {
+		h, ok := ParseCarrier(host)
+		if !ok || h == Unknown || h == Virtual {
+			return nil, fmt.Errorf("virtual carrier needs a host network, %s", s)
+		}
+		seg.Host = h
+	} else if len(host) > 0 {
+		return nil, fmt.Errorf("only virtual carrier has a host network, %s", s)
+	}
+	return seg, nil
+}
+
+func (t *Table) add(prefix string, seg *Segment) error {
+	prefix = strings.TrimSpace(prefix)
+	if len(prefix) == 0 {
+		return fmt.Errorf("empty segment")
+	}
+	n := &t.root
+	for i := 0; i < len(prefix); i++ {
+		d := prefix[i] - '0'
+		if d > 9 {
+			return fmt.Errorf("bad segment %s", prefix)
+		}
+		if n.next[d] == nil {
+			n.next[d] = &node{}
+		}
+		n = n.next[d]
+	}
+	if n.seg != nil {
+		return fmt.Errorf("duplicated segment %s", prefix)
+	}
+	n.seg = seg
+	t.size++
+	return nil
+}
+
+//Len returns the number of segments
+func (t *Table) Len() int {
+	return t.size
+}
+
+//Lookup returns the segment of a normalized 11 digits mobile number
+func (t *Table) Lookup(number string) Segment {
+	var found *Segment
+	n := &t.root
+	for i := 0; i < len(number); i++ {
+		d := number[i] - '0'
+		if d > 9 || n.next[d] == nil {
+			break
+		}
+		n = n.next[d]
+		if n.seg != nil {
+			found = n.seg
+		}
+	}
+	if found == nil {
+		return Segment{}
+	}
+	return *found
+}
+
+var (
+	lock  sync.RWMutex
+	table = mustParse(defaultSegments)
+)
+
+func mustParse(s string) *Table {
+	t, err := Parse(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+//Lookup resolves number with the current table
+func Lookup(number string) Segment {
+	lock.RLock()
+	t := table
+	lock.RUnlock()
+	return t.Lookup(number)
+}
+
+//Load replaces the current table with the segment file, the current
+//table is kept if the file is broken
+func Load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	t, err := Parse(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err.Error())
+	}
+	lock.Lock()
+	table = t
+	lock.Unlock()
+	return nil
+}
@@ -0,0 +1,133 @@
+package carrier
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//every published segment, padded to 11 digits
+var published = []struct {
+	segment string
+	carrier Carrier
+	host    Carrier
+}{
+	{"1340", Mobile, Mobile}, {"1341", Mobile, Mobile}, {"1342", Mobile, Mobile},
+	{"1343", Mobile, Mobile}, {"1344", Mobile, Mobile}, {"1345", Mobile, Mobile},
+	{"1346", Mobile, Mobile}, {"1347", Mobile, Mobile}, {"1348", Mobile, Mobile},
+	{"135", Mobile, Mobile}, {"136", Mobile, Mobile}, {"137", Mobile, Mobile},
+	{"138", Mobile, Mobile}, {"139", Mobile, Mobile}, {"147", Mobile, Mobile},
+	{"148", Mobile, Mobile}, {"150", Mobile, Mobile}, {"151", Mobile, Mobile},
+	{"152", Mobile, Mobile}, {"157", Mobile, Mobile}, {"158", Mobile, Mobile},
+	{"159", Mobile, Mobile}, {"172", Mobile, Mobile}, {"178", Mobile, Mobile},
+	{"182", Mobile, Mobile}, {"183", Mobile, Mobile}, {"184", Mobile, Mobile},
+	{"187", Mobile, Mobile}, {"188", Mobile, Mobile}, {"192", Mobile, Mobile},
+	{"195", Mobile, Mobile}, {"197", Mobile, Mobile}, {"198", Mobile, Mobile},
+	{"1440", Mobile, Mobile},
+
+	{"130", Unicom, Unicom}, {"131", Unicom, Unicom}, {"132", Unicom, Unicom},
+	{"145", Unicom, Unicom}, {"146", Unicom, Unicom}, {"155", Unicom, Unicom},
+	{"156", Unicom, Unicom}, {"166", Unicom, Unicom}, {"175", Unicom, Unicom},
+	{"176", Unicom, Unicom}, {"185", Unicom, Unicom}, {"186", Unicom, Unicom},
+	{"196", Unicom, Unicom}, {"1400", Unicom, Unicom},
+
+	{"133", Telecom, Telecom}, {"1349", Telecom, Telecom}, {"149", Telecom, Telecom},
+	{"153", Telecom, Telecom}, {"173", Telecom, Telecom}, {"1740", Telecom, Telecom},
+	{"177", Telecom, Telecom}, {"180", Telecom, Telecom}, {"181", Telecom, Telecom},
+	{"189", Telecom, Telecom}, {"190", Telecom, Telecom}, {"191", Telecom, Telecom},
+	{"193", Telecom, Telecom}, {"199", Telecom, Telecom}, {"1410", Telecom, Telecom},
+
+	{"162", Virtual, Telecom}, {"1700", Virtual, Telecom}, {"1701", Virtual, Telecom},
+	{"1702", Virtual, Telecom}, {"165", Virtual, Mobile}, {"1703", Virtual, Mobile},
+	{"1705", Virtual, Mobile}, {"1706", Virtual, Mobile}, {"167", Virtual, Unicom},
+	{"171", Virtual, Unicom}, {"1704", Virtual, Unicom}, {"1707", Virtual, Unicom},
+	{"1708", Virtual, Unicom}, {"1709", Virtual, Unicom},
+}
+
+func pad(segment string) string {
+	return segment + strings.Repeat("0", 11-len(segment))
+}
+
+func TestLookupPublished(t *testing.T) {
+	for _, v := range published {
+		seg := Lookup(pad(v.segment))
+		assert.Equal(t, v.carrier, seg.Carrier, v.segment)
+		assert.Equal(t, v.host, seg.Host, v.segment)
+	}
+	assert.Equal(t, len(published), table.Len())
+}
+
+func TestLookupUnknown(t *testing.T) {
+	for _, v := range []string{"", "1", "13", "10086", "12345678900", "17410000000", "abc", "1x800000000"} {
+		assert.Equal(t, Unknown, Lookup(v).Carrier, v)
+	}
+	//longest segment wins
+	assert.Equal(t, Telecom, Lookup("13490000000").Carrier)
+	assert.Equal(t, Mobile, Lookup("13480000000").Carrier)
+	assert.Equal(t, Virtual, Lookup("1709").Carrier)
+}
+
+func TestBit(t *testing.T) {
+	assert.Equal(t, 0, Unknown.Bit())
+	assert.Equal(t, 1, Mobile.Bit())
+	assert.Equal(t, 2, Unicom.Bit())
+	assert.Equal(t, 4, Telecom.Bit())
+	assert.Equal(t, 8, Virtual.Bit())
+	assert.True(t, Unicom.In(10))
+	assert.True(t, Virtual.In(10))
+	assert.False(t, Mobile.In(10))
+	assert.False(t, Unknown.In(15))
+	assert.True(t, ValidMask(0))
+	assert.True(t, ValidMask(AllMask))
+	assert.False(t, ValidMask(16))
+	assert.False(t, ValidMask(-1))
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{
+		"mobile",
+		"sprint 130",
+		"virtual 170",
+		"virtual/virtual 170",
+		"mobile/unicom 130",
+		"mobile 13a",
+		"mobile 130,,131",
+		"mobile 130\nunicom 130",
+	} {
+		_, err := Parse(strings.NewReader(s))
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carrier")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { table = mustParse(defaultSegments) }()
+
+	file := filepath.Join(dir, "segments.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("telecom 130\n"), 0644))
+	assert.NoError(t, Load(file))
+	assert.Equal(t, Telecom, Lookup("13000000000").Carrier)
+	assert.Equal(t, Unknown, Lookup("13800000000").Carrier)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("bad\n"), 0644))
+	assert.Error(t, Load(file))
+	assert.Equal(t, Telecom, Lookup("13000000000").Carrier)
+	assert.Error(t, Load(filepath.Join(dir, "none")))
+}
+
+func TestSegmentsFile(t *testing.T) {
+	f, err := os.Open("../segments.txt")
+	assert.NoError(t, err)
+	defer f.Close()
+	tb, err := Parse(f)
+	assert.NoError(t, err)
+	assert.Equal(t, table.Len(), tb.Len())
+	for _, v := range published {
+		assert.Equal(t, v.carrier, tb.Lookup(pad(v.segment)).Carrier, v.segment)
+	}
+}
@@ -0,0 +1,15 @@
+package carrier
+
+//defaultSegments is the built-in table, same format as segments.txt
+const defaultSegments = `
+# 中国移动，192为中国广电，使用移动网络
+mobile 1340,1341,1342,1343,1344,1345,1346,1347,1348,135,136,137,138,139,147,148,150,151,152,157,158,159,172,178,182,183,184,187,188,192,195,197,198,1440
+# 中国联通
+unicom 130,131,132,145,146,155,156,166,175,176,185,186,196,1400
+# 中国电信，1349、1740为卫星电话
+telecom 133,1349,149,153,173,1740,177,180,181,189,190,191,193,199,1410
+# 虚拟运营商
+virtual/telecom 162,1700,1701,1702
+virtual/mobile 165,1703,1705,1706
+virtual/unicom 167,171,1704,1707,1708,1709
+`
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"io"
+	"os"
+	"strings"
+	"sx/broker"
+	"sx/config"
+	"sx/push"
+)
+
+//command runs a subcommand given after the flags, ie:
+//sx -conf ./conf.yml parking replay
+func command(conf *config.Config, args []string) error {
+	if len(args) >= 2 && args[0] == "secret" && args[1] == "encrypt" {
+		return encryptSecret(conf, args[2:])
+	}
+	switch strings.Join(args, " ") {
+	case "parking replay":
+		return replay(conf, conf.ParkingQueue)
+	case "dlq replay":
+		if len(conf.DeadQueue) == 0 {
+			return fmt.Errorf("dlq.queue not configured")
+		}
+		return replay(conf, conf.DeadQueue)
+	}
+	return fmt.Errorf("unknown command %q, commands: parking replay, dlq replay, secret encrypt [value]", strings.Join(args, " "))
+}
+
+//replay feeds the messages of queue back through Push.Replay, those
+//failing again are parked or dead lettered anew
+func replay(conf *config.Config, queue string) error {
+	w, err := config.NewWatcher(conf.EtcdURL, conf)
+	if err != nil {
+		return err
+	}
+	if err = w.Load(conf.PrefixDir, conf.RuleKey, conf.BlockDir); err != nil {
+		return err
+	}
+	release, err := claimNode(conf)
+	if err != nil {
+		return err
+	}
+	defer release()
+	t, err := push.NewPusher(conf)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	n, err := broker.Drain(conf.RabbitmqAddrs, queue, t.Replay)
+	log.Info("replayed %d messages of %s", n, queue)
+	return err
+}
+
+//encryptSecret prints the ENC(...) value of the conf file for args[0], or
+//for the first line of stdin keeping it out of the shell history
+func encryptSecret(conf *config.Config, args []string) error {
+	master, err := config.MasterKey(conf.SecretKeyFile)
+	if err != nil {
+		return err
+	}
+	var plain string
+	if len(args) > 0 {
+		plain = args[0]
+	} else {
+		plain, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		plain = strings.TrimRight(plain, "\r\n")
+	}
+	if len(plain) == 0 {
+		return fmt.Errorf("nothing to encrypt")
+	}
+	enc, err := config.EncryptSecret(plain, master)
+	if err != nil {
+		return err
+	}
+	fmt.Println(enc)
+	return nil
+}
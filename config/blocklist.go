@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"github.com/coreos/etcd/clientv3"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ScopeGlobal is the blocklist scope applying to every vcc, the others
+//are vcc_ids
+const ScopeGlobal = "global"
+
+//BlockEntry is a blocked mobile, stored as json at
+//BlockDir/<scope>/<mobile>
+type BlockEntry struct {
+	By   string `json:"by"`   //who added it
+	At   int64  `json:"at"`   //unix seconds it was added
+	Note string `json:"note"` //why, ie: complaint
+}
+
+//Blocked returns the entry blocking mobile for vccID, the global list
+//first
+func (c *Config) Blocked(vccID int, mobile string) (string, *BlockEntry) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if e, ok := c.blocks[ScopeGlobal][mobile]; ok {
+		return ScopeGlobal, e
+	}
+	scope := strconv.Itoa(vccID)
+	if e, ok := c.blocks[scope][mobile]; ok {
+		return scope, e
+	}
+	return "", nil
+}
+
+//Blocks returns a copy of the blocklist of scope
+func (c *Config) Blocks(scope string) map[string]BlockEntry {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	m := make(map[string]BlockEntry, len(c.blocks[scope]))
+	for k, v := range c.blocks[scope] {
+		m[k] = *v
+	}
+	return m
+}
+
+func (c *Config) SetBlock(scope, mobile string, e *BlockEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.blocks[scope] == nil {
+		c.blocks[scope] = make(map[string]*BlockEntry)
+	}
+	c.blocks[scope][mobile] = e
+}
+
+func (c *Config) DelBlock(scope, mobile string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.blocks[scope], mobile)
+}
+
+//ValidScope checks scope is global or a vcc_id
+func ValidScope(scope string) error {
+	if scope == ScopeGlobal {
+		return nil
+	}
+	if id, err := strconv.Atoi(scope); err != nil || id <= 0 {
+		return fmt.Errorf("blocklist scope %q: want %s or a vcc_id", scope, ScopeGlobal)
+	}
+	return nil
+}
+
+//splitBlockKey returns scope and mobile of a key under dir
+func splitBlockKey(dir, key string) (string, string, bool) {
+	s := strings.SplitN(strings.TrimPrefix(key, dir+"/"), "/", 2)
+	if len(s) != 2 || len(s[0]) == 0 || len(s[1]) == 0 {
+		return "", "", false
+	}
+	return s[0], s[1], true
+}
+
+//WatchBlocklist loads and watches the blocklists under dir
+func (w *Watcher) WatchBlocklist(dir string) {
+	w.watch(dir, w.putBlock(dir), func(key string) {
+		if scope, mobile, ok := splitBlockKey(dir, key); ok {
+			w.conf.DelBlock(scope, mobile)
+		}
+	})
+}
+
+func (w *Watcher) putBlock(dir string) func(key string, value []byte) {
+	return func(key string, value []byte) {
+		scope, mobile, ok := splitBlockKey(dir, key)
+		if !ok {
+			log.Error("blocklist key %s", key)
+			return
+		}
+		var e BlockEntry
+		if err := json.Unmarshal(value, &e); err != nil {
+			log.Error("%s, key:%s", err.Error(), key)
+			return
+		}
+		w.conf.SetBlock(scope, mobile, &e)
+	}
+}
+
+//PutBlock stores a blocklist entry in etcd, the watch applies it
+func (w *Watcher) PutBlock(dir, scope, mobile string, e *BlockEntry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return w.do(func(ctx context.Context, c *clientv3.Client) error {
+		_, err := c.Put(ctx, dir+"/"+scope+"/"+mobile, string(buf))
+		return err
+	})
+}
+
+//DeleteBlock removes a blocklist entry from etcd
+func (w *Watcher) DeleteBlock(dir, scope, mobile string) error {
+	return w.do(func(ctx context.Context, c *clientv3.Client) error {
+		_, err := c.Delete(ctx, dir+"/"+scope+"/"+mobile)
+		return err
+	})
+}
+
+//do runs f with a client of its own
+func (w *Watcher) do(f func(ctx context.Context, c *clientv3.Client) error) error {
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   w.etcdURL,
+		DialTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return f(ctx, c)
+}
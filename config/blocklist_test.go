@@ -0,0 +1,37 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	conf := NewConfig()
+	w, _ := NewWatcher(nil, conf)
+	put := w.putBlock("/shanxinConfig/blocklist")
+	put("/shanxinConfig/blocklist/global/13800138000", []byte(`{"by":"ops","at":1,"note":"complaint"}`))
+	put("/shanxinConfig/blocklist/782/13900139000", []byte(`{"by":"icsoc","at":2}`))
+	put("/shanxinConfig/blocklist/782", []byte(`{}`))
+	put("/shanxinConfig/blocklist/782/13700137000", []byte(`{`))
+
+	scope, e := conf.Blocked(1, "13800138000")
+	assert.Equal(t, ScopeGlobal, scope)
+	assert.Equal(t, &BlockEntry{By: "ops", At: 1, Note: "complaint"}, e)
+	scope, e = conf.Blocked(782, "13900139000")
+	assert.Equal(t, "782", scope)
+	assert.Equal(t, "icsoc", e.By)
+	_, e = conf.Blocked(783, "13900139000")
+	assert.Nil(t, e)
+	_, e = conf.Blocked(782, "13700137000")
+	assert.Nil(t, e)
+	assert.Equal(t, map[string]BlockEntry{"13900139000": {By: "icsoc", At: 2}}, conf.Blocks("782"))
+
+	conf.DelBlock("782", "13900139000")
+	_, e = conf.Blocked(782, "13900139000")
+	assert.Nil(t, e)
+
+	assert.NoError(t, ValidScope("global"))
+	assert.NoError(t, ValidScope("782"))
+	assert.Error(t, ValidScope("x"))
+	assert.Error(t, ValidScope("0"))
+}
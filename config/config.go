@@ -3,7 +3,12 @@ package config
 import (
 	"fmt"
 	"github.com/spf13/viper"
+	"net"
+	"sort"
+	"strconv"
+	"sx/rule"
 	"sync"
+	"time"
 )
 
 //CREATE TABLE `cc_conf_flashsms` (
@@ -22,11 +27,49 @@ type FlashSMS struct {
 	ID      int
 	VccID   int `json:"vcc_id"`
 	Enable  bool
-	Msgflag int
-	Smsconf int
+	Msgflag int //bitmask of rule.Kind, 0 for every kind
+	Smsconf int //picks the provider, see Config.Smsconf
 	Tempid  int
-	Vendor  int
+	Vendor  int //bitmask of carrier.Carrier, 0 for every carrier
 	Param   string
+	Caps    string `json:"caps"` //overrides Config.Caps, off for no caps
+
+	//flash sends allowed per day and month, 0 for no limit
+	DailyQuota   int `json:"daily_quota"`
+	MonthlyQuota int `json:"monthly_quota"`
+
+	//send windows in a time zone, ie: mon-fri 09:00-21:00; sat,sun 10:00-18:00,
+	//events outside are dropped, or deferred until a window opens if
+	//Outside is defer. Always open if empty.
+	Windows  string `json:"windows"`
+	Timezone string `json:"timezone"`
+	Outside  string `json:"outside"`
+
+	Sandbox bool `json:"sandbox"` //payloads are built and logged but not posted
+
+	//ordinary sms sent when flash can't reach the number or is rejected,
+	//Fallback names a provider able to send text, FallbackText is a
+	//text/template, ie: {{.MSG.user_data.ClientName}}来电未接通
+	Fallback     string `json:"fallback"`
+	FallbackText string `json:"fallback_text"`
+}
+
+//ProviderConf configures one sms provider, Type names the implementation
+type ProviderConf struct {
+	Type      string
+	URL       string
+	Key       string
+	Operid    string
+	Caller    string
+	Tempid    string
+	Enterid   string
+	Enterpass string
+	Args      string
+
+	Cipher   string //field encryption, ie: aes-cbc-zero, see encrypt.ParseSpec
+	Padding  string //pkcs7 if empty
+	Encoding string //base64 if empty
+	IV       string //hex iv of a -fixed cipher
 }
 
 //Config for application use
@@ -36,7 +79,50 @@ type Config struct {
 	RabbitmqAddrs string //rabbitmq address
 	Exchange      string
 	QueueName     string
-	RoutingKey    []string
+
+	DryRun bool //no vcc posts to providers, as if each was in sandbox
+
+	RetryMax      int           //retries of a retryable send, 0 disables retry
+	RetryDelay    time.Duration //delay of the first retry, doubled on each attempt
+	RetryMaxDelay time.Duration //cap of the delay
+	RetryExchange string        //routes delayed messages back to QueueName
+	ParkingQueue  string        //messages still failing after RetryMax retries
+
+	DeadExchange string   //fanout exchange of events that can't be handled
+	DeadQueue    string   //bound to DeadExchange, empty disables dead lettering
+	DeadReasons  []string //skip reasons dead lettered, see push.Reason
+
+	DedupeTTL    time.Duration //how long a sent event is remembered, 0 disables dedupe
+	DedupeSize   int           //events remembered in memory
+	DedupePrefix string        //etcd prefix sharing sent events between instances, empty for memory only
+
+	Caps string //sends allowed to one mobile of a vcc, ie: 1/30m,3/24h
+
+	QuotaFile    string        //persists quota counters, memory only if empty
+	QuotaFlush   time.Duration //counters are written this often, sends since are lost on a crash
+	QuotaWarn    float64       //ratio of a quota raising a warning
+	QuotaWarnKey string        //routing key of warning events on Exchange, not published if empty
+
+	AdminAddr  string   //listen address of the admin http endpoints, ie: 127.0.0.1:8090
+	AdminToken string   //bearer token of the admin endpoints, required off loopback without AdminAllow
+	AdminAllow []string //addresses and CIDRs allowed to the admin endpoints, any if empty
+
+	DeferDir string //holds events deferred to a send window, memory only if empty
+
+	DLRAddr    string        //listen address of the delivery report pushes, reports are not taken if empty
+	DLRTimeout time.Duration //a send without a report by then expires
+	DLRToken   string        //token of the report pushes, required off loopback without DLRAllow
+	DLRAllow   []string      //addresses and CIDRs of the providers pushing reports, any if empty
+
+	LedgerDir       string        //keeps a record of each send, not recorded if empty
+	LedgerRetention time.Duration //records older are pruned
+	LedgerSecret    string        //keys the hash of recorded mobiles, required with LedgerDir
+
+	SeqNode    int           //node of the Sequenceids, -1 claims one under SeqNodeDir
+	SeqNodeDir string        //etcd prefix of the claimed nodes
+	SeqNodeTTL time.Duration //lease of a claimed node
+
+	SecretKeyFile string //master key of the ENC(...) values, see MasterKey
 
 	//RedisAddr    string //redis
 	//RedisDbIndex int
@@ -44,6 +130,10 @@ type Config struct {
 
 	EtcdURL   []string
 	PrefixDir string
+	RuleKey   string //etcd key of the json rule set, overrides Rules
+	BlockDir  string //etcd prefix of the blocklists, see BlockEntry
+
+	Segments string //carrier segment file, built-in table if empty
 
 	Key       string
 	Operid    string
@@ -54,11 +144,19 @@ type Config struct {
 	Args      string
 	URL       string
 
+	Providers       map[string]*ProviderConf //by name, shanxin above is "shanxin"
+	DefaultProvider string
+	Smsconf         map[int]string //FlashSMS.Smsconf to provider name
+
 	//base on upper config
 	PprofAddrs string
 
 	lock         sync.RWMutex
 	FlashSMSConf map[int]*FlashSMS
+	Rules        rule.Set
+	ruleHook     func(rule.Set)
+	blocks       map[string]map[string]*BlockEntry //by scope and mobile
+	secrets      []string                          //decrypted ENC(...) values
 }
 
 //NewConfig return a config struct
@@ -66,6 +164,7 @@ func NewConfig() *Config {
 	return &Config{
 		lock:         sync.RWMutex{},
 		FlashSMSConf: make(map[int]*FlashSMS),
+		blocks:       make(map[string]map[string]*BlockEntry),
 	}
 }
 
@@ -87,13 +186,68 @@ func (c *Config) Read(file string) error {
 	c.RabbitmqAddrs = vip.GetString("rabbitmq.addrs")
 	c.QueueName = vip.GetString("rabbitmq.queuename")
 	c.Exchange = vip.GetString("rabbitmq.exchange")
-	c.RoutingKey = vip.GetStringSlice("rabbitmq.routingKey")
+	c.DryRun = vip.GetBool("dryRun")
+	vip.SetDefault("retry.delay", "10s")
+	vip.SetDefault("retry.maxDelay", "10m")
+	vip.SetDefault("retry.exchange", c.QueueName+".retry")
+	vip.SetDefault("retry.parking", c.QueueName+".parking")
+	c.RetryMax = vip.GetInt("retry.max")
+	c.RetryDelay = vip.GetDuration("retry.delay")
+	c.RetryMaxDelay = vip.GetDuration("retry.maxDelay")
+	c.RetryExchange = vip.GetString("retry.exchange")
+	c.ParkingQueue = vip.GetString("retry.parking")
+	vip.SetDefault("dlq.exchange", c.QueueName+".dlx")
+	vip.SetDefault("dlq.reasons", []string{"bad_payload", "no_vcc_id", "no_rule", "panic"})
+	c.DeadExchange = vip.GetString("dlq.exchange")
+	c.DeadQueue = vip.GetString("dlq.queue")
+	c.DeadReasons = vip.GetStringSlice("dlq.reasons")
+	vip.SetDefault("dedupe.ttl", "1h")
+	vip.SetDefault("dedupe.size", 100000)
+	c.DedupeTTL = vip.GetDuration("dedupe.ttl")
+	c.DedupeSize = vip.GetInt("dedupe.size")
+	c.DedupePrefix = vip.GetString("dedupe.prefix")
+	c.Caps = vip.GetString("caps")
+	vip.SetDefault("quota.warn", 0.8)
+	vip.SetDefault("quota.flush", "1s")
+	c.QuotaFile = vip.GetString("quota.file")
+	c.QuotaFlush = vip.GetDuration("quota.flush")
+	c.QuotaWarn = vip.GetFloat64("quota.warn")
+	c.QuotaWarnKey = vip.GetString("quota.warnKey")
+	c.AdminAddr = vip.GetString("admin.addr")
+	c.AdminToken = vip.GetString("admin.token")
+	c.AdminAllow = vip.GetStringSlice("admin.allow")
+	c.DeferDir = vip.GetString("window.deferDir")
+	vip.SetDefault("dlr.timeout", "48h")
+	c.DLRAddr = vip.GetString("dlr.addr")
+	c.DLRTimeout = vip.GetDuration("dlr.timeout")
+	c.DLRToken = vip.GetString("dlr.token")
+	c.DLRAllow = vip.GetStringSlice("dlr.allow")
+	vip.SetDefault("ledger.retention", "720h")
+	c.LedgerDir = vip.GetString("ledger.dir")
+	c.LedgerRetention = vip.GetDuration("ledger.retention")
+	c.LedgerSecret = vip.GetString("ledger.secret")
+	vip.SetDefault("sequence.node", -1)
+	vip.SetDefault("sequence.nodeDir", "/shanxinConfig/nodes")
+	vip.SetDefault("sequence.ttl", "10s")
+	c.SeqNode = vip.GetInt("sequence.node")
+	c.SeqNodeDir = vip.GetString("sequence.nodeDir")
+	c.SeqNodeTTL = vip.GetDuration("sequence.ttl")
+	c.SecretKeyFile = vip.GetString("secret.keyFile")
+	if err = vip.UnmarshalKey("rules", &c.Rules); err != nil {
+		return err
+	}
+	if err = c.Rules.Validate(); err != nil {
+		return err
+	}
 
 	//c.RedisAddr = vip.GetString("redis.addrs")
 	//c.RedisDbIndex = vip.GetInt("redis.db")
 	//c.RedisMaxConn = vip.GetInt("redis.maxConn")
 	c.EtcdURL = vip.GetStringSlice("etcd.addrs")
 	c.PrefixDir = vip.GetString("etcd.prefixDir")
+	c.RuleKey = vip.GetString("etcd.ruleKey")
+	c.BlockDir = vip.GetString("etcd.blockDir")
+	c.Segments = vip.GetString("carrier.segments")
 	c.URL = vip.GetString("shanxin.url")
 	c.Key = vip.GetString("shanxin.key")
 	c.Operid = vip.GetString("shanxin.operid")
@@ -103,6 +257,46 @@ func (c *Config) Read(file string) error {
 	c.Enterpass = vip.GetString("shanxin.enterpass")
 	c.Args = vip.GetString("shanxin.args")
 
+	if err = vip.UnmarshalKey("providers", &c.Providers); err != nil {
+		return err
+	}
+	if c.Providers == nil {
+		c.Providers = make(map[string]*ProviderConf)
+	}
+	if _, ok := c.Providers["shanxin"]; !ok && vip.IsSet("shanxin") {
+		c.Providers["shanxin"] = &ProviderConf{
+			Type:      "shanxin",
+			URL:       c.URL,
+			Key:       c.Key,
+			Operid:    c.Operid,
+			Caller:    c.Caller,
+			Tempid:    c.Tempid,
+			Enterid:   c.Enterid,
+			Enterpass: c.Enterpass,
+			Args:      c.Args,
+			Cipher:    vip.GetString("shanxin.cipher"),
+			Padding:   vip.GetString("shanxin.padding"),
+			Encoding:  vip.GetString("shanxin.encoding"),
+			IV:        vip.GetString("shanxin.iv"),
+		}
+	}
+	c.DefaultProvider = vip.GetString("provider.default")
+	c.Smsconf = make(map[int]string)
+	for k, v := range vip.GetStringMapString("provider.smsconf") {
+		id, err := strconv.Atoi(k)
+		if err != nil {
+			return fmt.Errorf("provider.smsconf %s: %s", k, err.Error())
+		}
+		c.Smsconf[id] = v
+	}
+
+	if err = c.decryptSecrets(); err != nil {
+		return err
+	}
+	if err = c.check(); err != nil {
+		return err
+	}
+
 	//ip, err = utility.GetLocalIP(c.Interfacename)
 	//if err != nil {
 	//	return err
@@ -111,6 +305,33 @@ func (c *Config) Read(file string) error {
 	return nil
 }
 
+//check rejects combinations of the conf file that can't be served safely
+func (c *Config) check() error {
+	if len(c.AdminAddr) > 0 && len(c.AdminToken) == 0 && len(c.AdminAllow) == 0 && !loopback(c.AdminAddr) {
+		return fmt.Errorf("admin.addr %s listens off loopback, set admin.token or admin.allow", c.AdminAddr)
+	}
+	if len(c.LedgerDir) > 0 && len(c.LedgerSecret) == 0 {
+		return fmt.Errorf("ledger.dir %s needs ledger.secret to hash the recorded mobiles", c.LedgerDir)
+	}
+	if len(c.DLRAddr) > 0 && len(c.DLRToken) == 0 && len(c.DLRAllow) == 0 && !loopback(c.DLRAddr) {
+		return fmt.Errorf("dlr.addr %s listens off loopback, set dlr.token or dlr.allow", c.DLRAddr)
+	}
+	return nil
+}
+
+//loopback tells if the listen address addr only takes local connections
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func (c *Config) GetSmsConf(vccid int) (*FlashSMS, error) {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
@@ -137,3 +358,44 @@ func (c *Config) DelSmsConf(vccID int) error {
 	}
 	return nil
 }
+
+//SmsConfs returns every FlashSMS record ordered by vcc_id
+func (c *Config) SmsConfs() []*FlashSMS {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	s := make([]*FlashSMS, 0, len(c.FlashSMSConf))
+	for _, f := range c.FlashSMSConf {
+		s = append(s, f)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].VccID < s[j].VccID })
+	return s
+}
+
+//GetRules returns the current rule set
+func (c *Config) GetRules() rule.Set {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.Rules
+}
+
+//SetRules replaces the rule set and notifies the hook if any
+func (c *Config) SetRules(s rule.Set) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.Rules = s
+	hook := c.ruleHook
+	c.lock.Unlock()
+	if hook != nil {
+		hook(s)
+	}
+	return nil
+}
+
+//NotifyRules registers f to be called after the rule set changes
+func (c *Config) NotifyRules(f func(rule.Set)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ruleHook = f
+}
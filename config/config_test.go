@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -18,6 +20,17 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, "01057624343", conf.Caller)
 	fmt.Printf("%+v", conf)
 }
+
+func TestConfigRules(t *testing.T) {
+	conf := NewConfig()
+	err := conf.Read("../conf.yml")
+	assert.NoError(t, err)
+	rules := conf.GetRules()
+	assert.Equal(t, 3, len(rules))
+	assert.Equal(t, []string{"msgproxy.1.21", "msgproxy.2.10"}, rules.RoutingKeys())
+	assert.Equal(t, "trans_called", rules[1].Target)
+	assert.Equal(t, map[string]string{"status": "5"}, rules[1].When)
+}
 func TestWatcher_Watch(t *testing.T) {
 	TestWriteJson(t)
 	conf := NewConfig()
@@ -106,3 +119,27 @@ func TestWatcherWatchDelete(t *testing.T) {
 	}()
 	w.Watch("/liupengtest/vccid")
 }
+
+func TestConfigGuard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guard")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	read := func(yml string) error {
+		file := filepath.Join(dir, "conf.yml")
+		assert.NoError(t, ioutil.WriteFile(file, []byte(yml), 0644))
+		return NewConfig().Read(file)
+	}
+	assert.NoError(t, read("admin:\n  addr: 127.0.0.1:8090\n"))
+	assert.NoError(t, read("admin:\n  addr: localhost:8090\n"))
+	assert.NoError(t, read("admin:\n  addr: :8090\n  token: s3cret\n"))
+	assert.NoError(t, read("admin:\n  addr: :8090\n  allow: [10.0.0.0/8]\n"))
+	assert.Error(t, read("admin:\n  addr: :8090\n"))
+	assert.Error(t, read("admin:\n  addr: 0.0.0.0:8090\n"))
+
+	assert.NoError(t, read("dlr:\n  addr: :8091\n  token: s3cret\n"))
+	assert.NoError(t, read("dlr:\n  addr: :8091\n  allow: [203.0.113.0/24]\n"))
+	assert.Error(t, read("dlr:\n  addr: :8091\n"))
+
+	assert.NoError(t, read("ledger:\n  dir: ./ledger\n  secret: s3cret\n"))
+	assert.Error(t, read("ledger:\n  dir: ./ledger\n  secret: \"\"\n"))
+}
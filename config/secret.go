@@ -0,0 +1,178 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sx/encrypt"
+)
+
+//MasterKeyEnv names the environment variable holding the master key,
+//it is preferred over secret.keyFile
+const MasterKeyEnv = "SX_MASTER_KEY"
+
+//secretCipher encrypts the ENC(...) values with a key derived from the
+//master key, the random nonce is kept before the ciphertext
+const secretCipher = "aes-gcm"
+
+var encValue = regexp.MustCompile(`ENC\(([A-Za-z0-9+/=]*)\)`)
+
+//MasterKey returns the master key of the ENC(...) values, taken from
+//MasterKeyEnv or else from keyFile
+func MasterKey(keyFile string) (string, error) {
+	if k := os.Getenv(MasterKeyEnv); len(k) > 0 {
+		return k, nil
+	}
+	if len(keyFile) == 0 {
+		return "", fmt.Errorf("no master key, set %s or secret.keyFile", MasterKeyEnv)
+	}
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	k := strings.TrimSpace(string(b))
+	if len(k) == 0 {
+		return "", fmt.Errorf("master key file %s is empty", keyFile)
+	}
+	return k, nil
+}
+
+func secretCipherOf(master string) (encrypt.Cipher, error) {
+	sum := sha256.Sum256([]byte(master))
+	return encrypt.ByName(secretCipher, string(sum[:]))
+}
+
+//EncryptSecret returns plain as an ENC(...) value of the conf file
+func EncryptSecret(plain, master string) (string, error) {
+	c, err := secretCipherOf(master)
+	if err != nil {
+		return "", err
+	}
+	s, err := c.Encrypt(plain)
+	if err != nil {
+		return "", err
+	}
+	return "ENC(" + s + ")", nil
+}
+
+//DecryptSecret replaces each ENC(...) in s by its plain text, s is
+//returned as is if it has none
+func DecryptSecret(s, master string) (string, error) {
+	if !encValue.MatchString(s) {
+		return s, nil
+	}
+	c, err := secretCipherOf(master)
+	if err != nil {
+		return "", err
+	}
+	var derr error
+	s = encValue.ReplaceAllStringFunc(s, func(v string) string {
+		p, err := c.Decrypt(encValue.FindStringSubmatch(v)[1])
+		if err != nil && derr == nil {
+			derr = err
+		}
+		return p
+	})
+	return s, derr
+}
+
+//decryptSecrets replaces the ENC(...) values of the exported fields of c,
+//the master key is only needed if there are some
+func (c *Config) decryptSecrets() error {
+	var (
+		master string
+		err    error
+	)
+	decrypt := func(name, s string) (string, error) {
+		if !encValue.MatchString(s) {
+			return s, nil
+		}
+		if len(master) == 0 {
+			if master, err = MasterKey(c.SecretKeyFile); err != nil {
+				return "", fmt.Errorf("%s: %s", name, err.Error())
+			}
+		}
+		p, err := DecryptSecret(s, master)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", name, err.Error())
+		}
+		c.secrets = append(c.secrets, p)
+		return p, nil
+	}
+	return walkStrings(reflect.ValueOf(c).Elem(), "", decrypt)
+}
+
+//walkStrings sets each settable string under v to f of it
+func walkStrings(v reflect.Value, name string, f func(name, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := f(name, v.String())
+		if err != nil {
+			return err
+		}
+		if s == v.String() {
+			break
+		}
+		if !v.CanSet() {
+			return fmt.Errorf("%s: can't be an ENC(...) value", name)
+		}
+		v.SetString(s)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return walkStrings(v.Elem(), name, f)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if len(t.Field(i).PkgPath) > 0 {
+				continue //unexported
+			}
+			if err := walkStrings(v.Field(i), strings.TrimPrefix(name+"."+t.Field(i).Name, "."), f); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", name, i), f); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := v.MapIndex(k)
+			key := fmt.Sprintf("%s[%v]", name, k.Interface())
+			if e.Kind() != reflect.String {
+				if err := walkStrings(e, key, f); err != nil {
+					return err
+				}
+				continue
+			}
+			s, err := f(key, e.String())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(k, reflect.ValueOf(s).Convert(e.Type()))
+		}
+	}
+	return nil
+}
+
+//Secrets returns the values to be kept out of the logs, the decrypted
+//ENC(...) values besides the keys and passwords of the conf file
+func (c *Config) Secrets() []string {
+	s := append([]string{c.Key, c.Enterpass, c.LedgerSecret, c.AdminToken, c.DLRToken}, c.secrets...)
+	for _, p := range c.Providers {
+		s = append(s, p.Key, p.Enterpass)
+	}
+	if u, err := url.Parse(c.RabbitmqAddrs); err == nil && u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			s = append(s, p, url.QueryEscape(p))
+		}
+	}
+	return s
+}
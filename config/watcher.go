@@ -8,14 +8,13 @@ import (
 	"github.com/kubernetes/kubernetes/staging/src/k8s.io/apimachinery/pkg/util/json"
 	"strconv"
 	"strings"
-	"sync"
+	"sx/rule"
 	"time"
 )
 
 type Watcher struct {
 	etcdURL []string
 	conf    *Config
-	once    sync.Once
 }
 
 func NewWatcher(url []string, conf *Config) (*Watcher, error) {
@@ -24,14 +23,90 @@ func NewWatcher(url []string, conf *Config) (*Watcher, error) {
 	return &Watcher{
 		etcdURL: url,
 		conf:    conf,
-		once:    sync.Once{},
 	}, nil
 }
 
+//Watch loads and watches FlashSMS records under the name prefix
 func (w *Watcher) Watch(name string) {
+	w.watch(name, w.putSmsConf, func(key string) {
+		k, err := strconv.Atoi(strings.TrimPrefix(key, name+"/"))
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		w.conf.DelSmsConf(k)
+	})
+}
+
+//WatchRules loads and watches the json rule set stored at key,
+//deleting the key falls back to the rules of the config file
+func (w *Watcher) WatchRules(key string) {
+	fileRules := w.conf.GetRules()
+	w.watch(key, w.putRules(key), func(k string) {
+		if k == key {
+			w.conf.SetRules(fileRules)
+		}
+	})
+}
+
+func (w *Watcher) putRules(key string) func(k string, v []byte) {
+	return func(k string, v []byte) {
+		if k != key {
+			return
+		}
+		s, err := rule.Parse(v)
+		if err != nil {
+			log.Error("%s, key:%s", err.Error(), k)
+			return
+		}
+		w.conf.SetRules(s)
+	}
+}
+
+//Load gets the FlashSMS records under the name prefix, the rule set at
+//ruleKey and the blocklists under blockDir once, for commands that don't
+//run long enough to watch. ruleKey and blockDir may be empty.
+func (w *Watcher) Load(name, ruleKey, blockDir string) error {
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   w.etcdURL,
+		DialTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if _, err = load(c, name, w.putSmsConf); err != nil {
+		return err
+	}
+	if len(ruleKey) > 0 {
+		if _, err = load(c, ruleKey, w.putRules(ruleKey)); err != nil {
+			return err
+		}
+	}
+	if len(blockDir) > 0 {
+		_, err = load(c, blockDir, w.putBlock(blockDir))
+	}
+	return err
+}
+
+func (w *Watcher) putSmsConf(key string, value []byte) {
+	var f FlashSMS
+	if err := json.Unmarshal(value, &f); err != nil {
+		log.Error("%s, key:%s", err.Error(), key)
+		return
+	}
+	w.conf.SetSmsConf(&f)
+}
+
+//watch gets every key under the name prefix once, then follows changes
+//from the revision of that get, resuming after the last seen revision
+//on reconnect. If etcd compacted past it the keys are got again, keys
+//deleted meanwhile are only dropped on restart.
+func (w *Watcher) watch(name string, put func(key string, value []byte), del func(key string)) {
 	var (
 		err error
 		c   *clientv3.Client
+		rev int64 //next revision to watch, 0 gets the keys first
 	)
 	for {
 		if c, err = clientv3.New(clientv3.Config{
@@ -39,54 +114,62 @@ func (w *Watcher) Watch(name string) {
 			DialTimeout: 3 * time.Second,
 		}); err != nil {
 			log.Error(err)
+			time.Sleep(time.Second)
 			continue
 		}
-		w.once.Do(func() {
-			if resp, err := c.Get(context.Background(), name, clientv3.WithPrefix()); err == nil {
-				w.extractResponce(resp)
+		if rev == 0 {
+			if rev, err = load(c, name, put); err != nil {
+				log.Error(err)
+				c.Close()
+				time.Sleep(time.Second)
+				continue
 			}
-		})
+		}
 
-		rch := c.Watch(context.Background(), name, clientv3.WithPrefix())
+		rch := c.Watch(context.Background(), name, clientv3.WithPrefix(), clientv3.WithRev(rev))
 		for wresp := range rch {
 			for _, ev := range wresp.Events {
 				log.Debug("watcher watch event, key:%s, value:%s, type:%d",
 					string(ev.Kv.Key), string(ev.Kv.Value), ev.Type)
 				switch ev.Type {
 				case mvccpb.PUT:
-					var c FlashSMS
-					if err = json.Unmarshal(ev.Kv.Value, &c); err != nil {
-						log.Error(err)
-						continue
-					}
-					w.conf.SetSmsConf(&c)
+					put(string(ev.Kv.Key), ev.Kv.Value)
 				case mvccpb.DELETE:
-					key := strings.TrimLeft(string(ev.Kv.Key), name+"/")
-					k, err := strconv.Atoi(key)
-					if err != nil {
-						log.Error(err)
-						continue
-					}
-					w.conf.DelSmsConf(k)
+					del(string(ev.Kv.Key))
 				}
 			}
+			rev = resume(rev, wresp)
+			if err = wresp.Err(); err != nil {
+				log.Error("watch %s from revision %d: %s", name, rev, err.Error())
+			}
 		}
+		c.Close()
 	}
 }
 
-func (w *Watcher) extractResponce(resp *clientv3.GetResponse) {
-	if resp == nil || resp.Kvs == nil {
-		return
+//resume returns the revision to watch after wresp, 0 if it was compacted
+func resume(rev int64, wresp clientv3.WatchResponse) int64 {
+	if wresp.CompactRevision != 0 {
+		return 0
 	}
-	for i := range resp.Kvs {
-		if v := resp.Kvs[i].Value; v != nil {
-			var f FlashSMS
-			err := json.Unmarshal(v, &f)
-			log.Debug("%+v", f)
-			if err != nil {
-				continue
-			}
-			w.conf.SetSmsConf(&f)
+	for _, ev := range wresp.Events {
+		if ev.Kv.ModRevision >= rev {
+			rev = ev.Kv.ModRevision + 1
 		}
 	}
+	return rev
+}
+
+//load puts every key under the name prefix, returning the revision
+//following the get
+func load(c *clientv3.Client, name string, put func(key string, value []byte)) (int64, error) {
+	resp, err := c.Get(context.Background(), name, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	for _, kv := range resp.Kvs {
+		log.Debug("watcher load key:%s, value:%s", string(kv.Key), string(kv.Value))
+		put(string(kv.Key), kv.Value)
+	}
+	return resp.Header.Revision + 1, nil
 }
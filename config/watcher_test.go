@@ -0,0 +1,17 @@
+package config
+
+import (
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	ev := func(rev int64) *clientv3.Event {
+		return &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{ModRevision: rev}}
+	}
+	assert.Equal(t, int64(10), resume(10, clientv3.WatchResponse{}))
+	assert.Equal(t, int64(13), resume(10, clientv3.WatchResponse{Events: []*clientv3.Event{ev(10), ev(12)}}))
+	assert.Equal(t, int64(0), resume(10, clientv3.WatchResponse{CompactRevision: 11}))
+}
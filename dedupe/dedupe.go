@@ -0,0 +1,93 @@
+package dedupe
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//Store remembers the keys of handled events for a while
+type Store interface {
+	//Seen tells whether any of keys was marked and has not expired
+	Seen(keys ...string) (bool, error)
+	//Mark remembers keys
+	Mark(keys ...string) error
+}
+
+type entry struct {
+	key    string
+	expire time.Time
+}
+
+//LRU is an in-process Store holding at most size keys, the least
+//recently marked go first
+type LRU struct {
+	lock  sync.Mutex
+	ttl   time.Duration
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+//NewLRU creates a LRU keeping keys for ttl
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		ttl:   ttl,
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+func (c *LRU) Seen(keys ...string) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	for _, k := range keys {
+		e, ok := c.items[k]
+		if !ok {
+			continue
+		}
+		if now.Before(e.Value.(*entry).expire) {
+			return true, nil
+		}
+		c.remove(e)
+	}
+	return false, nil
+}
+
+func (c *LRU) Mark(keys ...string) error {
+	return c.MarkUntil(c.now().Add(c.ttl), keys...)
+}
+
+//MarkUntil remembers keys until expire instead of for the ttl
+func (c *LRU) MarkUntil(expire time.Time, keys ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, k := range keys {
+		if e, ok := c.items[k]; ok {
+			e.Value.(*entry).expire = expire
+			c.ll.MoveToFront(e)
+			continue
+		}
+		c.items[k] = c.ll.PushFront(&entry{key: k, expire: expire})
+		if c.size > 0 && c.ll.Len() > c.size {
+			c.remove(c.ll.Back())
+		}
+	}
+	return nil
+}
+
+//Len returns the number of keys held, expired ones included
+func (c *LRU) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*entry).key)
+}
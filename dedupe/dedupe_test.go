@@ -0,0 +1,90 @@
+package dedupe
+
+import (
+	"context"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	seen, err := c.Seen("a")
+	assert.NoError(t, err)
+	assert.False(t, seen)
+	assert.NoError(t, c.Mark("a", "b"))
+	seen, _ = c.Seen("x", "b")
+	assert.True(t, seen)
+
+	//a is the least recently marked
+	c.Mark("c")
+	assert.Equal(t, 2, c.Len())
+	seen, _ = c.Seen("a")
+	assert.False(t, seen)
+	seen, _ = c.Seen("b")
+	assert.True(t, seen)
+
+	now = now.Add(time.Minute)
+	seen, _ = c.Seen("b", "c")
+	assert.False(t, seen)
+	assert.Equal(t, 0, c.Len())
+
+	//marking again extends the ttl
+	c.Mark("d")
+	now = now.Add(50 * time.Second)
+	c.Mark("d")
+	now = now.Add(50 * time.Second)
+	seen, _ = c.Seen("d")
+	assert.True(t, seen)
+}
+
+func TestEtcdLease(t *testing.T) {
+	now := time.Now()
+	s := newEtcd("/dedupe", 10, time.Minute)
+	s.now = func() time.Time { return now }
+	grants := 0
+	s.grant = func(ctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+		grants++
+		assert.Equal(t, int64(66), ttl)
+		return clientv3.LeaseID(grants), nil
+	}
+	ctx := context.Background()
+
+	id, expire, err := s.leaseOf(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, clientv3.LeaseID(1), id)
+	assert.Equal(t, now.Add(66*time.Second), expire)
+	//shared within the window
+	now = now.Add(6 * time.Second)
+	id, _, _ = s.leaseOf(ctx)
+	assert.Equal(t, clientv3.LeaseID(1), id)
+	//would expire before ttl
+	now = now.Add(time.Second)
+	id, expire, _ = s.leaseOf(ctx)
+	assert.Equal(t, clientv3.LeaseID(2), id)
+	assert.Equal(t, now.Add(66*time.Second), expire)
+	assert.Equal(t, 2, grants)
+}
+
+func TestExpireOf(t *testing.T) {
+	at := time.Unix(1700000000, 123)
+	expire, ok := expireOf([]byte("1700000000000000123"))
+	assert.True(t, ok)
+	assert.True(t, at.Equal(expire))
+	_, ok = expireOf(nil)
+	assert.False(t, ok)
+}
+
+func TestMarkUntil(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(2, time.Hour)
+	c.now = func() time.Time { return now }
+	c.MarkUntil(now.Add(time.Minute), "a")
+	now = now.Add(time.Minute)
+	seen, _ := c.Seen("a")
+	assert.False(t, seen)
+}
@@ -0,0 +1,133 @@
+package dedupe
+
+import (
+	"context"
+	"github.com/coreos/etcd/clientv3"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//etcdTimeout bounds each etcd request
+var etcdTimeout = 2 * time.Second
+
+//Etcd is a Store shared by every instance, keys are put under prefix
+//with a lease of ttl and their expire time as value. A local LRU answers
+//for keys this instance marked or already found, until they expire in
+//etcd.
+//
+//Marks share one lease granted for ttl and a window, a key lives from
+//ttl to ttl and window, so a lease is not granted on every Mark.
+type Etcd struct {
+	client *clientv3.Client
+	prefix string
+	ttl    time.Duration
+	window time.Duration
+	cache  *LRU
+	now    func() time.Time
+	grant  func(ctx context.Context, ttl int64) (clientv3.LeaseID, error)
+
+	lock        sync.Mutex
+	lease       clientv3.LeaseID
+	leaseExpire time.Time
+}
+
+//NewEtcd creates an Etcd store
+func NewEtcd(endpoints []string, prefix string, size int, ttl time.Duration) (*Etcd, error) {
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := newEtcd(prefix, size, ttl)
+	s.client = c
+	s.grant = func(ctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+		resp, err := c.Grant(ctx, ttl)
+		if err != nil {
+			return 0, err
+		}
+		return resp.ID, nil
+	}
+	return s, nil
+}
+
+func newEtcd(prefix string, size int, ttl time.Duration) *Etcd {
+	window := ttl / 10
+	if window < time.Second {
+		window = time.Second
+	}
+	return &Etcd{prefix: prefix + "/", ttl: ttl, window: window, cache: NewLRU(size, ttl), now: time.Now}
+}
+
+func (s *Etcd) Seen(keys ...string) (bool, error) {
+	if seen, _ := s.cache.Seen(keys...); seen {
+		return true, nil
+	}
+	for _, k := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+		resp, err := s.client.Get(ctx, s.prefix+k)
+		cancel()
+		if err != nil {
+			return false, err
+		}
+		if len(resp.Kvs) > 0 {
+			if expire, ok := expireOf(resp.Kvs[0].Value); ok {
+				s.cache.MarkUntil(expire, k)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Etcd) Mark(keys ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	lease, expire, err := s.leaseOf(ctx)
+	if err != nil {
+		return err
+	}
+	s.cache.MarkUntil(expire, keys...)
+	value := strconv.FormatInt(expire.UnixNano(), 10)
+	for _, k := range keys {
+		if _, err = s.client.Put(ctx, s.prefix+k, value, clientv3.WithLease(lease)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//leaseOf returns the shared lease, a new one once the current expires
+//in less than ttl
+func (s *Etcd) leaseOf(ctx context.Context) (clientv3.LeaseID, time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.now()
+	if s.lease != 0 && !s.leaseExpire.Before(now.Add(s.ttl)) {
+		return s.lease, s.leaseExpire, nil
+	}
+	d := s.ttl + s.window
+	id, err := s.grant(ctx, int64((d+time.Second-1)/time.Second))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	s.lease, s.leaseExpire = id, now.Add(d)
+	return s.lease, s.leaseExpire, nil
+}
+
+//expireOf parses the value of a key, keys put before values were kept
+//have none and are not cached
+func expireOf(value []byte) (time.Time, bool) {
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+//Close closes the etcd client
+func (s *Etcd) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,205 @@
+package deferred
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//retryAfter is the wait before handing an item again when f failed
+var retryAfter = time.Minute
+
+//Item is a call event held until Due
+type Item struct {
+	ID         string    `json:"id"`
+	Due        time.Time `json:"due"`
+	RoutingKey string    `json:"routing_key"`
+	Body       []byte    `json:"body"`
+}
+
+//Store holds items until they are due, a store with a directory keeps
+//each item in a file so a restart doesn't lose them
+type Store struct {
+	dir   string
+	lock  sync.Mutex
+	items map[string]*Item
+	wake  chan struct{}
+	seq   uint64
+	now   func() time.Time
+}
+
+//Open loads the items of dir, creating it if missing, an empty dir keeps
+//items in memory only
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir, items: make(map[string]*Item), wake: make(chan struct{}, 1), now: time.Now}
+	if len(dir) == 0 {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var it Item
+		if err = json.Unmarshal(data, &it); err != nil {
+			log.Error("deferred item %s, %s", f.Name(), err.Error())
+			continue
+		}
+		s.items[it.ID] = &it
+	}
+	return s, nil
+}
+
+//Add holds it until it.Due, an ID is assigned if empty
+func (s *Store) Add(it *Item) error {
+	if len(it.ID) == 0 {
+		it.ID = fmt.Sprintf("%d-%d", s.now().UnixNano(), atomic.AddUint64(&s.seq, 1))
+	}
+	if err := s.write(it); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.items[it.ID] = it
+	s.lock.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+//Len returns the number of items held
+func (s *Store) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.items)
+}
+
+//Due hands the items due by now to f and removes those f handled, an
+//item f failed is handed again after a while. It returns when the next
+//item is due, zero if none is held.
+func (s *Store) Due(f func(it *Item) error) time.Time {
+	now := s.now()
+	s.lock.Lock()
+	var due []*Item
+	for _, it := range s.items {
+		if !it.Due.After(now) {
+			due = append(due, it)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, it := range due {
+		if err := f(it); err != nil {
+			log.Error("deferred item %s, %s", it.ID, err.Error())
+			s.postpone(it, now.Add(retryAfter))
+			continue
+		}
+		s.remove(it)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var next time.Time
+	for _, it := range s.items {
+		if next.IsZero() || it.Due.Before(next) {
+			next = it.Due
+		}
+	}
+	return next
+}
+
+//Run hands items to f as they are due until done is closed
+func (s *Store) Run(f func(it *Item) error, done <-chan struct{}) {
+	for {
+		wait := time.Hour
+		if next := s.Due(f); !next.IsZero() {
+			wait = next.Sub(s.now())
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-s.wake:
+			t.Stop()
+		case <-done:
+			t.Stop()
+			return
+		}
+	}
+}
+
+//postpone holds a copy of it due at due instead of it, held items are
+//not changed as others may be reading them. The copy is written so a
+//restart keeps the new due time.
+func (s *Store) postpone(it *Item, due time.Time) {
+	s.lock.Lock()
+	if s.items[it.ID] != it {
+		s.lock.Unlock()
+		return
+	}
+	later := *it
+	later.Due = due
+	s.items[it.ID] = &later
+	s.lock.Unlock()
+	if err := s.write(&later); err != nil {
+		log.Error("deferred item %s, %s", it.ID, err.Error())
+	}
+}
+
+func (s *Store) remove(it *Item) {
+	s.lock.Lock()
+	delete(s.items, it.ID)
+	s.lock.Unlock()
+	if len(s.dir) > 0 {
+		if err := os.Remove(s.file(it)); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+func (s *Store) file(it *Item) string {
+	return filepath.Join(s.dir, it.ID+".json")
+}
+
+//write stores it in a temporary file renamed to its own
+func (s *Store) write(it *Item) error {
+	if len(s.dir) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, it.ID+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file(it))
+}
@@ -0,0 +1,112 @@
+package deferred
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deferred")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	s, err := Open(dir)
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+	assert.NoError(t, s.Add(&Item{Due: now.Add(time.Hour), RoutingKey: "msgproxy.1.21", Body: []byte("a")}))
+	assert.NoError(t, s.Add(&Item{Due: now.Add(2 * time.Hour), RoutingKey: "msgproxy.1.21", Body: []byte("b")}))
+
+	//restarted
+	s, err = Open(dir)
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+	assert.Equal(t, 2, s.Len())
+
+	var got []string
+	handle := func(it *Item) error {
+		got = append(got, string(it.Body))
+		return nil
+	}
+	next := s.Due(handle)
+	assert.Nil(t, got)
+	assert.True(t, now.Add(time.Hour).Equal(next))
+
+	now = now.Add(time.Hour)
+	next = s.Due(handle)
+	assert.Equal(t, []string{"a"}, got)
+	assert.True(t, now.Add(time.Hour).Equal(next))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files))
+
+	//failed, handed again later
+	now = now.Add(time.Hour)
+	next = s.Due(func(it *Item) error { return errors.New("x") })
+	assert.True(t, now.Add(retryAfter).Equal(next))
+	assert.Equal(t, 1, s.Len())
+	//restarted, still postponed
+	s, err = Open(dir)
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+	assert.True(t, now.Add(retryAfter).Equal(s.Due(handle)))
+	assert.Equal(t, []string{"a"}, got)
+
+	now = next
+	next = s.Due(handle)
+	assert.Equal(t, []string{"a", "b"}, got)
+	assert.True(t, next.IsZero())
+	files, _ = ioutil.ReadDir(dir)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestRun(t *testing.T) {
+	s, err := Open("")
+	assert.NoError(t, err)
+	got := make(chan string, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go s.Run(func(it *Item) error {
+		got <- string(it.Body)
+		return nil
+	}, done)
+	assert.NoError(t, s.Add(&Item{Due: time.Now().Add(50 * time.Millisecond), Body: []byte("a")}))
+	select {
+	case b := <-got:
+		assert.Equal(t, "a", b)
+	case <-time.After(3 * time.Second):
+		t.Fatal("item not handed")
+	}
+	assert.Equal(t, 0, s.Len())
+}
+
+//TestDueConcurrent is for go test -race, failed items are postponed while
+//another Due reads them
+func TestDueConcurrent(t *testing.T) {
+	s, err := Open("")
+	assert.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, s.Add(&Item{Due: now}))
+	}
+	//failed items stay due
+	defer func(d time.Duration) { retryAfter = d }(retryAfter)
+	retryAfter = 0
+	fail := func(it *Item) error { return errors.New("x") }
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			s.Due(fail)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		s.Due(fail)
+	}
+	<-done
+	assert.Equal(t, 10, s.Len())
+}
@@ -0,0 +1,130 @@
+package dlr
+
+import (
+	"sync"
+	"time"
+)
+
+//State is where a send stands, every state but Pending is final
+type State string
+
+const (
+	Pending   State = "pending"
+	Delivered State = "delivered" //displayed on the handset
+	Failed    State = "failed"    //refused by the network or the handset
+	Expired   State = "expired"   //no report came in time, or the network gave up
+)
+
+//Report is a delivery report pushed by a provider
+type Report struct {
+	Sequenceid string
+	Mobile     string
+	State      State
+	Desc       string //status of the provider, ie: DELIVRD
+	Time       time.Time
+}
+
+//Send is a message accepted by a provider
+type Send struct {
+	Sequenceid string    `json:"sequenceid"`
+	Provider   string    `json:"provider"`
+	VccID      int       `json:"vcc_id"`
+	CallID     string    `json:"call_id"`
+	Mobile     string    `json:"mobile"`
+	SentAt     time.Time `json:"sent_at"`
+	State      State     `json:"state"`
+	Desc       string    `json:"desc"`
+	DoneAt     time.Time `json:"done_at"` //when the state became final
+}
+
+//Tracker holds sends until a report finishes them or they expire,
+//finished sends are handed to done
+type Tracker struct {
+	lock    sync.Mutex
+	pending map[string]*Send
+	timeout time.Duration
+	done    func(s *Send)
+	now     func() time.Time
+}
+
+//NewTracker creates a Tracker expiring sends without a report after
+//timeout, done may be nil
+func NewTracker(timeout time.Duration, done func(s *Send)) *Tracker {
+	if done == nil {
+		done = func(*Send) {}
+	}
+	return &Tracker{pending: make(map[string]*Send), timeout: timeout, done: done, now: time.Now}
+}
+
+//Track holds s until its report
+func (t *Tracker) Track(s *Send) {
+	s.State = Pending
+	if s.SentAt.IsZero() {
+		s.SentAt = t.now()
+	}
+	t.lock.Lock()
+	t.pending[s.Sequenceid] = s
+	t.lock.Unlock()
+}
+
+//Report finishes the send of r, it returns false if no send is pending
+//for r.Sequenceid, ie: it expired already
+func (t *Tracker) Report(r *Report) (*Send, bool) {
+	t.lock.Lock()
+	s, ok := t.pending[r.Sequenceid]
+	delete(t.pending, r.Sequenceid)
+	t.lock.Unlock()
+	if !ok {
+		return nil, false
+	}
+	s.State, s.Desc, s.DoneAt = r.State, r.Desc, r.Time
+	if s.DoneAt.IsZero() {
+		s.DoneAt = t.now()
+	}
+	t.done(s)
+	return s, true
+}
+
+//Len returns the number of pending sends
+func (t *Tracker) Len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.pending)
+}
+
+//Sweep expires the sends pending longer than the timeout
+func (t *Tracker) Sweep() []*Send {
+	now := t.now()
+	var stale []*Send
+	t.lock.Lock()
+	for id, s := range t.pending {
+		if now.Sub(s.SentAt) >= t.timeout {
+			delete(t.pending, id)
+			stale = append(stale, s)
+		}
+	}
+	t.lock.Unlock()
+	for _, s := range stale {
+		s.State, s.Desc, s.DoneAt = Expired, "no report", now
+		t.done(s)
+	}
+	return stale
+}
+
+//Run sweeps every tenth of the timeout until done is closed
+func (t *Tracker) Run(done <-chan struct{}) {
+	every := t.timeout / 10
+	if every < time.Second {
+		every = time.Second
+	}
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			t.Sweep()
+		case <-done:
+			return
+		}
+	}
+}
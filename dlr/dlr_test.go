@@ -0,0 +1,44 @@
+package dlr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Now()
+	var done []*Send
+	tr := NewTracker(time.Hour, func(s *Send) { done = append(done, s) })
+	tr.now = func() time.Time { return now }
+
+	tr.Track(&Send{Sequenceid: "1", VccID: 782})
+	tr.Track(&Send{Sequenceid: "2", VccID: 782})
+	tr.Track(&Send{Sequenceid: "3", VccID: 782})
+	assert.Equal(t, 3, tr.Len())
+
+	s, ok := tr.Report(&Report{Sequenceid: "1", State: Delivered, Desc: "DELIVRD", Time: now.Add(time.Second)})
+	assert.True(t, ok)
+	assert.Equal(t, Delivered, s.State)
+	assert.Equal(t, now.Add(time.Second), s.DoneAt)
+	_, ok = tr.Report(&Report{Sequenceid: "1", State: Failed})
+	assert.False(t, ok)
+
+	now = now.Add(30 * time.Minute)
+	tr.Track(&Send{Sequenceid: "4"})
+	now = now.Add(30 * time.Minute)
+	stale := tr.Sweep()
+	assert.Equal(t, 2, len(stale))
+	assert.Equal(t, Expired, stale[0].State)
+	assert.Equal(t, 1, tr.Len())
+
+	//reported after expiring
+	_, ok = tr.Report(&Report{Sequenceid: "2", State: Delivered})
+	assert.False(t, ok)
+	assert.Equal(t, 3, len(done))
+
+	_, ok = tr.Report(&Report{Sequenceid: "4", State: Failed, Desc: "UNDELIV"})
+	assert.True(t, ok)
+	assert.Equal(t, now, done[3].DoneAt)
+	assert.Equal(t, 0, tr.Len())
+}
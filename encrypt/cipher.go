@@ -0,0 +1,322 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sx/encrypt/sm4"
+)
+
+//Cipher encrypts the fields of a payload to text and back
+type Cipher interface {
+	Encrypt(plain string) (string, error)
+	Decrypt(text string) (string, error)
+}
+
+//Modes of a Spec
+const (
+	CBC = "cbc"
+	GCM = "gcm" //the random nonce precedes the sealed data, no padding
+	ECB = "ecb" //only for providers requiring it, equal blocks show
+)
+
+//IVs of a CBC Spec
+const (
+	IVZero   = "zero"   //deterministic, what Shanxin expects
+	IVFixed  = "fixed"  //Spec.FixedIV
+	IVRandom = "random" //a new iv precedes each ciphertext
+)
+
+//Paddings of CBC and ECB
+const (
+	PKCS7     = "pkcs7"
+	ZeroPad   = "zero" //trailing zero bytes, values ending with 0 don't survive
+	NoPadding = "none" //values must be whole blocks
+)
+
+//Encodings of the ciphertext
+const (
+	Base64Std    = "base64"
+	Base64URL    = "base64url"
+	Base64RawStd = "base64raw"
+	Base64RawURL = "base64rawurl"
+	Hex          = "hex"
+)
+
+//Spec tells how a Cipher encrypts. Names are block-mode[-iv], ie:
+//aes-cbc-zero, the iv of CBC defaults to IVZero, padding and encoding
+//to PKCS7 and Base64Std.
+type Spec struct {
+	Block    string //aes or sm4
+	Mode     string
+	IV       string //of CBC
+	FixedIV  []byte //of IVFixed
+	Padding  string
+	Encoding string
+}
+
+//Name returns the name of s
+func (s Spec) Name() string {
+	name := s.Block + "-" + s.Mode
+	if s.Mode == CBC {
+		name += "-" + s.IV
+	}
+	return name
+}
+
+//blocks creates the block cipher of a key by Spec.Block
+var blocks = map[string]func(key []byte) (cipher.Block, error){
+	"aes": func(key []byte) (cipher.Block, error) {
+		return aes.NewCipher(getKey(key))
+	},
+	//SM4 keys are 16 bytes, shorter ones are padded like AES keys
+	"sm4": func(key []byte) (cipher.Block, error) {
+		return sm4.NewCipher(getKey(key))
+	},
+}
+
+var encodings = map[string]interface {
+	EncodeToString(src []byte) string
+	DecodeString(s string) ([]byte, error)
+}{
+	Base64Std:    base64.StdEncoding,
+	Base64URL:    base64.URLEncoding,
+	Base64RawStd: base64.RawStdEncoding,
+	Base64RawURL: base64.RawURLEncoding,
+	Hex:          hexEncoding{},
+}
+
+type hexEncoding struct{}
+
+func (hexEncoding) EncodeToString(src []byte) string       { return hex.EncodeToString(src) }
+func (hexEncoding) DecodeString(s string) ([]byte, error) { return hex.DecodeString(s) }
+
+//ParseSpec parses a cipher name, padding and encoding may be empty for
+//the defaults, fixedIV is the hex iv of IVFixed
+func ParseSpec(name, padding, encoding, fixedIV string) (Spec, error) {
+	s := Spec{Padding: padding, Encoding: encoding}
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(name)), "-")
+	if len(parts) < 2 {
+		return s, fmt.Errorf("cipher %q: want block-mode[-iv], ie: aes-cbc-zero", name)
+	}
+	s.Block, s.Mode = parts[0], parts[1]
+	if s.Mode == CBC && len(parts) == 3 {
+		s.IV = parts[2]
+	} else if len(parts) != 2 {
+		return s, fmt.Errorf("cipher %q: want block-mode[-iv], ie: aes-cbc-zero", name)
+	}
+	if len(fixedIV) > 0 {
+		iv, err := hex.DecodeString(fixedIV)
+		if err != nil {
+			return s, fmt.Errorf("cipher %q iv: %s", name, err.Error())
+		}
+		s.FixedIV = iv
+	}
+	return s, s.check()
+}
+
+func (s *Spec) check() error {
+	if _, ok := blocks[s.Block]; !ok {
+		return fmt.Errorf("cipher %s: unknown block %q, known %v", s.Name(), s.Block, keys(blocks))
+	}
+	if len(s.Encoding) == 0 {
+		s.Encoding = Base64Std
+	}
+	if _, ok := encodings[s.Encoding]; !ok {
+		return fmt.Errorf("cipher %s: unknown encoding %q", s.Name(), s.Encoding)
+	}
+	switch s.Mode {
+	case GCM:
+		if len(s.Padding) > 0 && s.Padding != NoPadding {
+			return fmt.Errorf("cipher %s: gcm takes no padding", s.Name())
+		}
+		s.Padding = NoPadding
+		return nil
+	case CBC:
+		switch s.IV {
+		case "":
+			s.IV = IVZero
+		case IVZero, IVRandom:
+		case IVFixed:
+			if len(s.FixedIV) == 0 {
+				return fmt.Errorf("cipher %s: iv not configured", s.Name())
+			}
+		default:
+			return fmt.Errorf("cipher %s: iv %q, want %s, %s or %s", s.Name(), s.IV, IVZero, IVFixed, IVRandom)
+		}
+	case ECB:
+	default:
+		return fmt.Errorf("cipher %s: unknown mode %q", s.Name(), s.Mode)
+	}
+	switch s.Padding {
+	case "":
+		s.Padding = PKCS7
+	case PKCS7, ZeroPad, NoPadding:
+	default:
+		return fmt.Errorf("cipher %s: unknown padding %q", s.Name(), s.Padding)
+	}
+	return nil
+}
+
+func keys(m map[string]func([]byte) (cipher.Block, error)) []string {
+	var s []string
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+//NewCipher creates the Cipher of s with key, the block cipher is built
+//once
+func NewCipher(s Spec, key string) (Cipher, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	block, err := blocks[s.Block]([]byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("cipher %s: %s", s.Name(), err.Error())
+	}
+	c := &blockCipher{spec: s, block: block, enc: encodings[s.Encoding]}
+	switch {
+	case s.Mode == GCM:
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("cipher %s: %s", s.Name(), err.Error())
+		}
+	case s.Mode == CBC && s.IV == IVZero:
+		c.iv = make([]byte, block.BlockSize())
+	case s.Mode == CBC && s.IV == IVFixed:
+		if len(s.FixedIV) != block.BlockSize() {
+			return nil, fmt.Errorf("cipher %s: iv of %d bytes, want %d", s.Name(), len(s.FixedIV), block.BlockSize())
+		}
+		c.iv = s.FixedIV
+	}
+	return c, nil
+}
+
+//ByName creates the Cipher named name with the default padding and
+//encoding
+func ByName(name, key string) (Cipher, error) {
+	s, err := ParseSpec(name, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(s, key)
+}
+
+type blockCipher struct {
+	spec  Spec
+	block cipher.Block
+	aead  cipher.AEAD
+	iv    []byte //nil for a random one
+	enc   interface {
+		EncodeToString(src []byte) string
+		DecodeString(s string) ([]byte, error)
+	}
+}
+
+func (c *blockCipher) Encrypt(plain string) (string, error) {
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plain)+c.aead.Overhead())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		return c.enc.EncodeToString(c.aead.Seal(nonce, nonce, []byte(plain), nil)), nil
+	}
+	bs := c.block.BlockSize()
+	data, err := pad([]byte(plain), bs, c.spec.Padding)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case c.spec.Mode == ECB:
+		for i := 0; i < len(data); i += bs {
+			c.block.Encrypt(data[i:i+bs], data[i:i+bs])
+		}
+	case c.iv != nil:
+		cipher.NewCBCEncrypter(c.block, c.iv).CryptBlocks(data, data)
+	default:
+		out := make([]byte, bs+len(data))
+		if _, err := io.ReadFull(rand.Reader, out[:bs]); err != nil {
+			return "", err
+		}
+		cipher.NewCBCEncrypter(c.block, out[:bs]).CryptBlocks(out[bs:], data)
+		data = out
+	}
+	return c.enc.EncodeToString(data), nil
+}
+
+func (c *blockCipher) Decrypt(text string) (string, error) {
+	data, err := c.enc.DecodeString(text)
+	if err != nil {
+		return "", decryptError(BadEncoding, err)
+	}
+	if c.aead != nil {
+		n := c.aead.NonceSize()
+		if len(data) < n+c.aead.Overhead() {
+			return "", decryptError(TooShort, nil)
+		}
+		plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+		if err != nil {
+			return "", decryptError(Unauthentic, err)
+		}
+		return string(plain), nil
+	}
+	bs := c.block.BlockSize()
+	iv := c.iv
+	if c.spec.Mode == CBC && iv == nil {
+		if len(data) < bs {
+			return "", decryptError(TooShort, nil)
+		}
+		iv, data = data[:bs], data[bs:]
+	}
+	if len(data) == 0 || len(data)%bs != 0 {
+		return "", decryptError(NotBlocks, nil)
+	}
+	if c.spec.Mode == ECB {
+		for i := 0; i < len(data); i += bs {
+			c.block.Decrypt(data[i:i+bs], data[i:i+bs])
+		}
+	} else {
+		cipher.NewCBCDecrypter(c.block, iv).CryptBlocks(data, data)
+	}
+	plain, err := unpad(data, bs, c.spec.Padding)
+	return string(plain), err
+}
+
+//pad pads data to whole blocks, the result doesn't share data
+func pad(data []byte, bs int, padding string) ([]byte, error) {
+	switch padding {
+	case PKCS7:
+		return PKCS7Padding(append([]byte(nil), data...), bs), nil
+	case ZeroPad:
+		n := (len(data) + bs - 1) / bs * bs
+		if n == 0 {
+			n = bs
+		}
+		out := make([]byte, n)
+		copy(out, data)
+		return out, nil
+	}
+	if len(data)%bs != 0 || len(data) == 0 {
+		return nil, fmt.Errorf("%d bytes without padding, want whole blocks of %d", len(data), bs)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func unpad(data []byte, bs int, padding string) ([]byte, error) {
+	switch padding {
+	case PKCS7:
+		return PKCS7Unpad(data, bs)
+	case ZeroPad:
+		return bytes.TrimRight(data, "\x00"), nil
+	}
+	return data, nil
+}
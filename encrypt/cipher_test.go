@@ -0,0 +1,150 @@
+package encrypt
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testKey = "hg62159393"
+
+func TestCipherWire(t *testing.T) {
+	for _, c := range []struct {
+		name, padding, encoding, iv string
+		plain, want                 string
+	}{
+		//what Shanxin expects, the same as AESBase64Encrypt
+		{"aes-cbc-zero", "", "", "", "12345", "NK70GParXbt2OezynLUSPA=="},
+		{"aes-cbc-zero", "", "", "", "20190409135500123_7777", "lUgjXpbNmiJbO300RbZHWmoZ7kApbqDpQIvBO/9P28Q="},
+		{"aes-cbc-zero", "", Hex, "", "12345", "34aef418f6ab5dbb7639ecf29cb5123c"},
+		{"aes-cbc-zero", ZeroPad, Base64URL, "", "20190409135500123_7777", "lUgjXpbNmiJbO300RbZHWgksafvlTOJ-x59elb5rJKY="},
+		{"aes-cbc-fixed", "", Base64RawStd, "000102030405060708090a0b0c0d0e0f", "12345", "IZzHQjBrAQo60m92a7/2BQ"},
+		//the first block as with a zero iv, the second not chained
+		{"aes-ecb", "", "", "", "20190409135500123_7777", "lUgjXpbNmiJbO300RbZHWrseUTSJFugpMfr77CwLUys="},
+		{"aes-ecb", NoPadding, Hex, "", "0123456789abcdef0123456789abcdef", "3a8bfc6070607bb0b6eabba4a0fa90173a8bfc6070607bb0b6eabba4a0fa9017"},
+	} {
+		s, err := ParseSpec(c.name, c.padding, c.encoding, c.iv)
+		assert.NoError(t, err, c.name)
+		ci, err := NewCipher(s, testKey)
+		assert.NoError(t, err, c.name)
+		got, err := ci.Encrypt(c.plain)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.want, got, "%s %s %s", c.name, c.padding, c.encoding)
+		plain, err := ci.Decrypt(got)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.plain, plain, c.name)
+	}
+
+	//the iv of cbc defaults to zero
+	ci, err := ByName("aes-cbc", testKey)
+	assert.NoError(t, err)
+	got, _ := ci.Encrypt("12345")
+	assert.Equal(t, "NK70GParXbt2OezynLUSPA==", got)
+
+	legacy, _ := AESBase64Encrypt("ClientName", testKey)
+	ci, err = ByName("aes-cbc-zero", testKey)
+	assert.NoError(t, err)
+	got, _ = ci.Encrypt("ClientName")
+	assert.Equal(t, legacy, got)
+}
+
+func TestCipherRandom(t *testing.T) {
+	for _, name := range []string{"aes-cbc-random", "aes-gcm"} {
+		ci, err := ByName(name, testKey)
+		assert.NoError(t, err)
+		a, err := ci.Encrypt("18627826073")
+		assert.NoError(t, err)
+		b, _ := ci.Encrypt("18627826073")
+		assert.NotEqual(t, a, b, name)
+		for _, v := range []string{a, b} {
+			plain, err := ci.Decrypt(v)
+			assert.NoError(t, err)
+			assert.Equal(t, "18627826073", plain)
+		}
+		empty, _ := ci.Encrypt("")
+		plain, err := ci.Decrypt(empty)
+		assert.NoError(t, err)
+		assert.Equal(t, "", plain)
+	}
+
+	//the iv precedes a single block
+	ci, _ := ByName("aes-cbc-random", testKey)
+	v, _ := ci.Encrypt("12345")
+	data, _ := base64.StdEncoding.DecodeString(v)
+	assert.Equal(t, 32, len(data))
+	legacy, err := AesCBCDncrypt(data, getKey([]byte(testKey)))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", string(legacy))
+
+	//tampered
+	ci, _ = ByName("aes-gcm", testKey)
+	v, _ = ci.Encrypt("12345")
+	data, _ = base64.StdEncoding.DecodeString(v)
+	data[len(data)-1] ^= 1
+	_, err = ci.Decrypt(base64.StdEncoding.EncodeToString(data))
+	assert.Error(t, err)
+}
+
+func TestCipherErrors(t *testing.T) {
+	for _, c := range [][4]string{
+		{"aes", "", "", ""},
+		{"des-cbc-zero", "", "", ""},
+		{"aes-ctr", "", "", ""},
+		{"aes-cbc-fixed", "", "", ""},
+		{"aes-cbc-fixed", "", "", "zz"},
+		{"aes-gcm-zero", "", "", ""},
+		{"aes-gcm", PKCS7, "", ""},
+		{"aes-ecb", "ansi", "", ""},
+		{"aes-ecb", "", "base32", ""},
+	} {
+		_, err := ParseSpec(c[0], c[1], c[2], c[3])
+		assert.Error(t, err, "%v", c)
+	}
+	s, _ := ParseSpec("aes-cbc-fixed", "", "", "0001")
+	_, err := NewCipher(s, testKey)
+	assert.Error(t, err)
+
+	ci, _ := ByName("aes-cbc-zero", testKey)
+	for _, v := range []string{"", "!", "YWJj", "NK70GParXbt2OezynLUSPA"} {
+		_, err = ci.Decrypt(v)
+		assert.Error(t, err, v)
+	}
+	s, _ = ParseSpec("aes-ecb", NoPadding, "", "")
+	ci, _ = NewCipher(s, testKey)
+	_, err = ci.Encrypt("12345")
+	assert.Error(t, err)
+}
+
+func TestCipherSM4(t *testing.T) {
+	//the example of GB/T 32907-2016 through the ecb helper
+	key, _ := hex.DecodeString("0123456789abcdeffedcba9876543210")
+	s, err := ParseSpec("sm4-ecb", NoPadding, Hex, "")
+	assert.NoError(t, err)
+	ci, err := NewCipher(s, string(key))
+	assert.NoError(t, err)
+	got, err := ci.Encrypt(string(key))
+	assert.NoError(t, err)
+	assert.Equal(t, "681edf34d206965e86b3e94f536e4246", got)
+
+	//cbc with a zero iv, the first block as ecb
+	s, _ = ParseSpec("sm4-cbc", "", Hex, "")
+	ci, err = NewCipher(s, string(key))
+	assert.NoError(t, err)
+	got, err = ci.Encrypt(string(key) + "x")
+	assert.NoError(t, err)
+	assert.Equal(t, "681edf34d206965e86b3e94f536e4246", got[:32])
+	assert.Equal(t, 64, len(got))
+
+	for _, name := range []string{"sm4-cbc", "sm4-cbc-random", "sm4-ecb", "sm4-gcm"} {
+		ci, err := ByName(name, testKey)
+		assert.NoError(t, err, name)
+		v, err := ci.Encrypt("20190409135500123_7777")
+		assert.NoError(t, err)
+		plain, err := ci.Decrypt(v)
+		assert.NoError(t, err)
+		assert.Equal(t, "20190409135500123_7777", plain, name)
+	}
+	_, err = ByName("sm4-cbc", "0123456789abcdef0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package encrypt
+
+import (
+	"crypto/subtle"
+)
+
+//Reason is why a ciphertext could not be decrypted
+type Reason string
+
+const (
+	BadEncoding Reason = "bad_encoding" //not base64 or hex
+	Empty       Reason = "empty"
+	TooShort    Reason = "too_short"   //shorter than the iv or nonce
+	NotBlocks   Reason = "not_blocks"  //not whole blocks
+	BadPadding  Reason = "bad_padding" //length or bytes of the padding wrong
+	Unauthentic Reason = "unauthentic" //gcm tag mismatch, tampered or wrong key
+	BadKey      Reason = "bad_key"     //the key makes no cipher
+)
+
+//DecryptError is a ciphertext that could not be decrypted, Err is the
+//underlying error if any
+type DecryptError struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *DecryptError) Error() string {
+	if e.Err != nil {
+		return "decrypt: " + string(e.Reason) + ", " + e.Err.Error()
+	}
+	return "decrypt: " + string(e.Reason)
+}
+
+func decryptError(r Reason, err error) error {
+	return &DecryptError{Reason: r, Err: err}
+}
+
+//PKCS7Unpad removes the PKCS7 padding of data, a whole number of
+//blocks. The padding bytes are checked in constant time.
+func PKCS7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, decryptError(Empty, nil)
+	}
+	if blockSize <= 0 || blockSize > 255 || len(data)%blockSize != 0 {
+		return nil, decryptError(NotBlocks, nil)
+	}
+	n := int(data[len(data)-1])
+	good := subtle.ConstantTimeLessOrEq(1, n) & subtle.ConstantTimeLessOrEq(n, blockSize)
+	//check the whole last block so the time doesn't tell n
+	last := data[len(data)-blockSize:]
+	for i := 0; i < blockSize; i++ {
+		inPad := subtle.ConstantTimeLessOrEq(blockSize-n, i)
+		same := subtle.ConstantTimeByteEq(last[i], byte(n))
+		good &= subtle.ConstantTimeSelect(inPad, same, 1)
+	}
+	if good != 1 {
+		return nil, decryptError(BadPadding, nil)
+	}
+	return data[:len(data)-n], nil
+}
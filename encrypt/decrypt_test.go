@@ -0,0 +1,119 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func reason(err error) Reason {
+	var e *DecryptError
+	if errors.As(err, &e) {
+		return e.Reason
+	}
+	return ""
+}
+
+func TestPKCS7Unpad(t *testing.T) {
+	block := bytes.Repeat([]byte{'a'}, 16)
+	for n := 1; n <= 16; n++ {
+		data := PKCS7Padding(block[:16-n%16], 16)
+		got, err := PKCS7Unpad(data, 16)
+		assert.NoError(t, err)
+		assert.Equal(t, block[:16-n%16], got)
+	}
+	for _, c := range []struct {
+		data []byte
+		want Reason
+	}{
+		{nil, Empty},
+		{[]byte{1, 2, 3}, NotBlocks},
+		{append(bytes.Repeat([]byte{'a'}, 15), 0), BadPadding},
+		{append(bytes.Repeat([]byte{'a'}, 15), 17), BadPadding},
+		{append(bytes.Repeat([]byte{'a'}, 14), 3, 2), BadPadding},
+		{append(bytes.Repeat([]byte{'a'}, 13), 3, 2, 3), BadPadding},
+		{bytes.Repeat([]byte{0xff}, 16), BadPadding},
+	} {
+		_, err := PKCS7Unpad(c.data, 16)
+		assert.Equal(t, c.want, reason(err), "%v", c.data)
+	}
+	assert.Nil(t, PKCS7UnPadding([]byte{}))
+}
+
+func TestDecryptErrors(t *testing.T) {
+	_, err := AESBase64Decrypt("%%", testKey)
+	assert.Equal(t, BadEncoding, reason(err))
+	_, err = Dncrypt("%%", []byte(testKey))
+	assert.Equal(t, BadEncoding, reason(err))
+	_, err = AesCBCDncrypt([]byte("short"), []byte(testKey))
+	assert.Equal(t, TooShort, reason(err))
+	_, err = AesCBCDncrypt(make([]byte, 16), []byte(testKey))
+	assert.Equal(t, NotBlocks, reason(err))
+	//a wrong key garbles the padding
+	enc, _ := AESBase64Encrypt("12345", testKey)
+	_, err = AESBase64Decrypt(enc, "another")
+	assert.Equal(t, BadPadding, reason(err))
+	assert.EqualError(t, err, "decrypt: bad_padding")
+
+	//the same key normalization as encryption
+	raw, err := AesCBCEncrypt([]byte("12345"), []byte(testKey))
+	assert.NoError(t, err)
+	plain, err := AesCBCDncrypt(raw, []byte(testKey))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", string(plain))
+	plain, err = AesCBCDncrypt(raw, []byte(testKey))
+	assert.NoError(t, err, "ciphertext kept")
+	_, err = AesCBCDncrypt(raw, make([]byte, 33))
+	assert.Equal(t, BadKey, reason(err))
+
+	ci, _ := ByName("aes-gcm", testKey)
+	_, err = ci.Decrypt(base64.StdEncoding.EncodeToString(make([]byte, 40)))
+	assert.Equal(t, Unauthentic, reason(err))
+	_, err = ci.Decrypt("AAAA")
+	assert.Equal(t, TooShort, reason(err))
+}
+
+//FuzzDecrypt feeds arbitrary ciphertext to every decrypt path, none may
+//panic and every failure is a DecryptError
+func FuzzDecrypt(f *testing.F) {
+	for _, v := range []string{"", "NK70GParXbt2OezynLUSPA==", "HaxDzm34lg0MFEsI+xBwFg==", "YWJj", "%%"} {
+		f.Add(v)
+	}
+	var ciphers []Cipher
+	for _, name := range []string{"aes-cbc-zero", "aes-cbc-random", "aes-gcm", "aes-ecb", "sm4-cbc"} {
+		ci, err := ByName(name, testKey)
+		if err != nil {
+			f.Fatal(err)
+		}
+		ciphers = append(ciphers, ci)
+	}
+	check := func(t *testing.T, err error) {
+		if err != nil && len(reason(err)) == 0 {
+			t.Fatalf("untyped error %v", err)
+		}
+	}
+	f.Fuzz(func(t *testing.T, v string) {
+		_, err := AESBase64Decrypt(v, testKey)
+		check(t, err)
+		_, err = Dncrypt(v, []byte(testKey))
+		check(t, err)
+		_, err = AesCBCDncrypt([]byte(v), []byte(testKey))
+		check(t, err)
+		_, err = PKCS7Unpad([]byte(v), 16)
+		check(t, err)
+		for _, ci := range ciphers {
+			_, err = ci.Decrypt(v)
+			check(t, err)
+		}
+		//valid base64 of the raw bytes too
+		b64 := base64.StdEncoding.EncodeToString([]byte(v))
+		_, err = AESBase64Decrypt(b64, testKey)
+		check(t, err)
+		for _, ci := range ciphers {
+			_, err = ci.Decrypt(b64)
+			check(t, err)
+		}
+	})
+}
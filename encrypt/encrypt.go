@@ -6,7 +6,6 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
 	"io"
 )
 
@@ -21,10 +20,16 @@ func PKCS7Padding(ciphertext []byte, blockSize int) []byte {
 	return append(ciphertext, padtext...)
 }
 
+//PKCS7UnPadding removes the padding of 16 byte blocks, nil if it is
+//not valid.
+//
+//Deprecated: use PKCS7Unpad.
 func PKCS7UnPadding(origData []byte) []byte {
-	length := len(origData)
-	unpadding := int(origData[length-1])
-	return origData[:(length - unpadding)]
+	data, err := PKCS7Unpad(origData, aes.BlockSize)
+	if err != nil {
+		return nil
+	}
+	return data
 }
 
 func getKey(key []byte) []byte {
@@ -94,32 +99,34 @@ func AesCBCEncrypt2(rawData, key []byte) ([]byte, error) {
 	return cipherText, nil
 }
 
+//AesCBCDncrypt decrypts the output of AesCBCEncrypt, the iv precedes
+//the ciphertext
 func AesCBCDncrypt(encryptData, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+	block, err := aes.NewCipher(getKey(key))
 	if err != nil {
-		return nil, err
+		return nil, decryptError(BadKey, err)
 	}
 
 	blockSize := block.BlockSize()
 
 	if len(encryptData) < blockSize {
-		return nil, errors.New("ciphertext too short")
+		return nil, decryptError(TooShort, nil)
 	}
 	iv := encryptData[:blockSize]
 	encryptData = encryptData[blockSize:]
 
 	// CBC mode always works in whole blocks.
-	if len(encryptData)%blockSize != 0 {
-		return nil, errors.New("ciphertext is not a multiple of the block size")
+	if len(encryptData) == 0 || len(encryptData)%blockSize != 0 {
+		return nil, decryptError(NotBlocks, nil)
 	}
 
 	mode := cipher.NewCBCDecrypter(block, iv)
 
-	// CryptBlocks can work in-place if the two arguments are the same.
-	mode.CryptBlocks(encryptData, encryptData)
+	//decrypted into a copy, encryptData is the caller's
+	data := make([]byte, len(encryptData))
+	mode.CryptBlocks(data, encryptData)
 	//解填充
-	encryptData = PKCS7UnPadding(encryptData)
-	return encryptData, nil
+	return PKCS7Unpad(data, blockSize)
 }
 
 func Encrypt(rawData, key []byte) (string, error) {
@@ -133,9 +140,9 @@ func Encrypt(rawData, key []byte) (string, error) {
 func Dncrypt(rawData string, key []byte) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(rawData) //StdEncoding
 	if err != nil {
-		return "", err
+		return "", decryptError(BadEncoding, err)
 	}
-	dnData, err := AesCBCDncrypt(data, getKey(key))
+	dnData, err := AesCBCDncrypt(data, key)
 	if err != nil {
 		return "", err
 	}
@@ -156,3 +163,22 @@ func AESBase64Encrypt(originData string, key string) (base64Result string, err e
 	base64Result = base64.StdEncoding.EncodeToString(dst) //RawStdEncoding
 	return
 }
+
+//AESBase64Decrypt reverses AESBase64Encrypt
+func AESBase64Decrypt(base64Data string, key string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return "", decryptError(BadEncoding, err)
+	}
+	block, err := aes.NewCipher(getKey([]byte(key)))
+	if err != nil {
+		return "", decryptError(BadKey, err)
+	}
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return "", decryptError(NotBlocks, nil)
+	}
+	iv := make([]byte, block.BlockSize())
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	data, err = PKCS7Unpad(data, block.BlockSize())
+	return string(data), err
+}
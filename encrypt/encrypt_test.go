@@ -66,3 +66,24 @@ func TestAESBase64Encrypt(t *testing.T) {
 	}
 
 }
+
+func TestAESBase64Decrypt(t *testing.T) {
+	dec, err := AESBase64Decrypt("NK70GParXbt2OezynLUSPA==", "hg62159393")
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", dec)
+
+	for _, v := range []string{"", "a", "20190409135500123_7777"} {
+		enc, err := AESBase64Encrypt(v, "hg62159393")
+		assert.NoError(t, err)
+		dec, err = AESBase64Decrypt(enc, "hg62159393")
+		assert.NoError(t, err)
+		assert.Equal(t, v, dec)
+	}
+
+	_, err = AESBase64Decrypt("", "hg62159393")
+	assert.Error(t, err)
+	_, err = AESBase64Decrypt("not base64", "hg62159393")
+	assert.Error(t, err)
+	_, err = AESBase64Decrypt("YWJj", "hg62159393")
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package sm4
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+//TestVectors are the examples of GB/T 32907-2016 appendix A
+func TestVectors(t *testing.T) {
+	key := unhex("0123456789abcdeffedcba9876543210")
+	c, err := NewCipher(key)
+	assert.NoError(t, err)
+
+	dst := make([]byte, BlockSize)
+	c.Encrypt(dst, key)
+	assert.Equal(t, "681edf34d206965e86b3e94f536e4246", hex.EncodeToString(dst))
+	c.Decrypt(dst, dst)
+	assert.Equal(t, key, dst)
+
+	if testing.Short() {
+		return
+	}
+	copy(dst, key)
+	for i := 0; i < 1000000; i++ {
+		c.Encrypt(dst, dst)
+	}
+	assert.Equal(t, "595298c7c6fd271f0402f804c33d3f66", hex.EncodeToString(dst))
+	for i := 0; i < 1000000; i++ {
+		c.Decrypt(dst, dst)
+	}
+	assert.Equal(t, key, dst)
+}
+
+func TestSbox(t *testing.T) {
+	var seen [256]bool
+	for _, b := range sbox {
+		assert.False(t, seen[b], "%02x twice", b)
+		seen[b] = true
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	for _, n := range []int{0, 15, 17, 32} {
+		_, err := NewCipher(make([]byte, n))
+		assert.Equal(t, KeySizeError(n), err)
+	}
+}
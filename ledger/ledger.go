@@ -0,0 +1,321 @@
+package ledger
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sx/redact"
+	"sync"
+	"time"
+)
+
+//States of an entry besides the delivery report states of package dlr
+const (
+	Accepted = "accepted" //taken by the provider, no report expected
+	Error    = "error"    //the send failed, see Error
+	DryRun   = "dry_run"  //logged, not posted
+)
+
+//dayLayout names the file of a day, utc
+const dayLayout = "20060102"
+
+//Entry is one send attempt. Mobile is masked, MobileHash finds the
+//entries of a number without storing it.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	VccID      int       `json:"vcc_id,omitempty"`
+	CallID     string    `json:"call_id,omitempty"`
+	Mobile     string    `json:"mobile,omitempty"`
+	MobileHash string    `json:"mobile_hash,omitempty"`
+	Provider   string    `json:"provider,omitempty"`
+	Template   string    `json:"template,omitempty"`
+	Sequenceid string    `json:"sequenceid,omitempty"`
+	Code       string    `json:"code,omitempty"`
+	Desc       string    `json:"desc,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	State      string    `json:"state"`
+	DoneAt     time.Time `json:"done_at,omitempty"`
+	//Update marks a line finishing the entry of Sequenceid
+	Update bool `json:"update,omitempty"`
+}
+
+//Query selects entries, zero fields match any
+type Query struct {
+	VccID  int
+	CallID string
+	Mobile string //as sent, it is hashed to match
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+//Ledger appends entries to a file a day under dir, files older than
+//the retention are removed
+type Ledger struct {
+	dir       string
+	retention time.Duration
+	secret    []byte
+	lock      sync.Mutex
+	day       string
+	f         *os.File
+	now       func() time.Time
+}
+
+//Open opens the ledger of dir, creating it if missing, mobiles are
+//hashed with secret. An empty secret is refused, the hash of a mobile
+//with a known key is reversed by trying every number.
+func Open(dir string, retention time.Duration, secret string) (*Ledger, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("ledger secret empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Ledger{dir: dir, retention: retention, secret: []byte(secret), now: time.Now}, nil
+}
+
+//Mask hides the middle of a mobile, ie: 138****8000
+func Mask(mobile string) string {
+	return redact.Mask(mobile)
+}
+
+//Hash returns the keyed hash of mobile
+func (l *Ledger) Hash(mobile string) string {
+	h := hmac.New(sha256.New, l.secret)
+	h.Write([]byte(mobile))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+//Add appends e, its Mobile is masked and hashed
+func (l *Ledger) Add(e *Entry) error {
+	if e.Time.IsZero() {
+		e.Time = l.now()
+	}
+	if len(e.Mobile) > 0 {
+		e.MobileHash = l.Hash(e.Mobile)
+		e.Mobile = Mask(e.Mobile)
+	}
+	return l.append(e)
+}
+
+//Finish records the final state of the entry of sequenceid
+func (l *Ledger) Finish(sequenceid, state, desc string, at time.Time) error {
+	return l.append(&Entry{Time: l.now(), Sequenceid: sequenceid, State: state, Desc: desc, DoneAt: at, Update: true})
+}
+
+func (l *Ledger) append(e *Entry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	day := l.now().UTC().Format(dayLayout)
+	if l.f == nil || day != l.day {
+		if l.f != nil {
+			l.f.Close()
+		}
+		if l.f, err = open(l.file(day)); err != nil {
+			return err
+		}
+		l.day = day
+	}
+	if _, err = l.f.Write(buf); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+//open opens file for appending, a line left unfinished by a crash is
+//ended so that the next entry starts a line of its own
+func open(file string) (*os.File, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			_, err = f.Write([]byte{'\n'})
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (l *Ledger) file(day string) string {
+	return filepath.Join(l.dir, day+".jsonl")
+}
+
+//days returns the days having a file, oldest first
+func (l *Ledger) days() ([]string, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, f := range files {
+		day := strings.TrimSuffix(f.Name(), ".jsonl")
+		if f.IsDir() || day == f.Name() {
+			continue
+		}
+		if _, err := time.Parse(dayLayout, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+//Query returns the entries matching q, newest first. The final state
+//of an entry may be written days later, so files up to the last are
+//read for updates.
+func (l *Ledger) Query(q Query) ([]Entry, error) {
+	days, err := l.days()
+	if err != nil {
+		return nil, err
+	}
+	hash := ""
+	if len(q.Mobile) > 0 {
+		hash = l.Hash(q.Mobile)
+	}
+	var entries []Entry
+	bySeq := make(map[string][]int)
+	for _, day := range days {
+		start, _ := time.Parse(dayLayout, day)
+		if !q.To.IsZero() && start.After(q.To) && len(bySeq) == 0 {
+			break
+		}
+		if !q.From.IsZero() && start.Add(24*time.Hour).Before(q.From) {
+			continue
+		}
+		err := l.scan(day, func(e *Entry) {
+			if e.Update {
+				for _, i := range bySeq[e.Sequenceid] {
+					entries[i].State, entries[i].Desc, entries[i].DoneAt = e.State, e.Desc, e.DoneAt
+				}
+				return
+			}
+			if !match(e, &q, hash) {
+				return
+			}
+			if len(e.Sequenceid) > 0 {
+				bySeq[e.Sequenceid] = append(bySeq[e.Sequenceid], len(entries))
+			}
+			entries = append(entries, *e)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
+
+func match(e *Entry, q *Query, hash string) bool {
+	switch {
+	case q.VccID != 0 && e.VccID != q.VccID,
+		len(q.CallID) > 0 && e.CallID != q.CallID,
+		len(hash) > 0 && e.MobileHash != hash,
+		!q.From.IsZero() && e.Time.Before(q.From),
+		!q.To.IsZero() && e.Time.After(q.To):
+		return false
+	}
+	return true
+}
+
+//scan hands each entry of the file of day to f, broken lines are
+//skipped, ie: the last one after a crash
+func (l *Ledger) scan(day string, f func(e *Entry)) error {
+	file, err := os.Open(l.file(day))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			log.Warn("ledger %s, %s", day, err.Error())
+			continue
+		}
+		f(&e)
+	}
+	return sc.Err()
+}
+
+//Prune removes the files of the days past the retention
+func (l *Ledger) Prune() error {
+	days, err := l.days()
+	if err != nil {
+		return err
+	}
+	oldest := l.now().UTC().Add(-l.retention).Format(dayLayout)
+	for _, day := range days {
+		if day >= oldest {
+			break
+		}
+		l.lock.Lock()
+		if day == l.day && l.f != nil {
+			l.f.Close()
+			l.f = nil
+		}
+		err = os.Remove(l.file(day))
+		l.lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("ledger prune %s, %s", day, err.Error())
+		}
+		log.Info("ledger %s pruned", day)
+	}
+	return nil
+}
+
+//Run prunes every hour until done is closed
+func (l *Ledger) Run(done <-chan struct{}) {
+	tick := time.NewTicker(time.Hour)
+	defer tick.Stop()
+	for {
+		if err := l.Prune(); err != nil {
+			log.Error(err)
+		}
+		select {
+		case <-tick.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+//Close closes the file of the day
+func (l *Ledger) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,89 @@
+package ledger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	_, err = Open(dir, 48*time.Hour, "")
+	assert.Error(t, err)
+	l, err := Open(dir, 48*time.Hour, "salt")
+	assert.NoError(t, err)
+	l.now = func() time.Time { return now }
+
+	assert.NoError(t, l.Add(&Entry{VccID: 782, CallID: "c1", Mobile: "13800138000", Sequenceid: "s1", State: "pending"}))
+	now = now.Add(time.Minute)
+	assert.NoError(t, l.Add(&Entry{VccID: 783, CallID: "c2", Mobile: "13800138001", Sequenceid: "s2", State: Error, Error: "http status 502"}))
+	now = now.Add(24 * time.Hour)
+	assert.NoError(t, l.Add(&Entry{VccID: 782, CallID: "c3", Mobile: "13800138000", Sequenceid: "s3", State: "pending"}))
+	//the report of the day before
+	assert.NoError(t, l.Finish("s1", "delivered", "DELIVRD", now))
+
+	all, err := l.Query(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(all))
+	assert.Equal(t, "s3", all[0].Sequenceid)
+	assert.Equal(t, "138****8000", all[2].Mobile)
+	assert.Equal(t, "delivered", all[2].State)
+	assert.Equal(t, now, all[2].DoneAt)
+
+	got, err := l.Query(Query{Mobile: "13800138000"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(got))
+	got, err = l.Query(Query{VccID: 782, CallID: "c1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	got, err = l.Query(Query{From: now.Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	//updates are read past To
+	got, err = l.Query(Query{To: now.Add(-time.Hour), Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, "s2", got[0].Sequenceid)
+	got, err = l.Query(Query{To: now.Add(-time.Hour), CallID: "c1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "delivered", got[0].State)
+
+	//a broken last line, ie: a crash while writing
+	f, _ := os.OpenFile(filepath.Join(dir, "20261016.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"time":`)
+	f.Close()
+	all, err = l.Query(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(all))
+	//reopened after the crash, the broken line is ended first
+	l, err = Open(dir, 48*time.Hour, "salt")
+	assert.NoError(t, err)
+	l.now = func() time.Time { return now }
+	assert.NoError(t, l.Add(&Entry{VccID: 784}))
+	got, err = l.Query(Query{VccID: 784})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+
+	now = now.Add(48 * time.Hour)
+	assert.NoError(t, l.Prune())
+	all, err = l.Query(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(all))
+	assert.Equal(t, "s3", all[0].Sequenceid)
+	assert.NoError(t, l.Add(&Entry{VccID: 782}))
+	assert.NoError(t, l.Close())
+}
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "138****8000", Mask("13800138000"))
+	assert.Equal(t, "010****4343", Mask("01057624343"))
+	assert.Equal(t, "123***7890", Mask("1234567890"))
+	assert.Equal(t, "***", Mask("123"))
+}
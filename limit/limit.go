@@ -0,0 +1,130 @@
+package limit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Cap allows at most N sends within Window
+type Cap struct {
+	N      int
+	Window time.Duration
+}
+
+func (c Cap) String() string {
+	return strconv.Itoa(c.N) + "/" + c.Window.String()
+}
+
+//Off disables the caps of a vcc
+const Off = "off"
+
+//ParseCaps parses comma separated caps, ie: 1/30m,3/24h. Empty and Off
+//give no caps.
+func ParseCaps(spec string) ([]Cap, error) {
+	spec = strings.TrimSpace(spec)
+	if len(spec) == 0 || spec == Off {
+		return nil, nil
+	}
+	var caps []Cap
+	for _, s := range strings.Split(spec, ",") {
+		i := strings.Index(s, "/")
+		if i < 0 {
+			return nil, fmt.Errorf("cap %q: want count/window", s)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(s[:i]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("cap %q: bad count", s)
+		}
+		w, err := time.ParseDuration(strings.TrimSpace(s[i+1:]))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("cap %q: bad window", s)
+		}
+		caps = append(caps, Cap{N: n, Window: w})
+	}
+	return caps, nil
+}
+
+//sweepEvery is how many records between sweeps of idle keys
+const sweepEvery = 1024
+
+//Limiter keeps the recent send times of each key in memory
+type Limiter struct {
+	lock    sync.Mutex
+	sends   map[string][]time.Time
+	longest time.Duration //longest window seen, older sends are dropped
+	records int
+	now     func() time.Time
+}
+
+//NewLimiter creates a Limiter
+func NewLimiter() *Limiter {
+	return &Limiter{
+		sends: make(map[string][]time.Time),
+		now:   time.Now,
+	}
+}
+
+//Allow returns the first of caps key reached, nil if another send is
+//allowed
+func (l *Limiter) Allow(key string, caps []Cap) *Cap {
+	if len(caps) == 0 {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	sends := l.sends[key]
+	for i := range caps {
+		n := 0
+		for _, t := range sends {
+			if now.Sub(t) < caps[i].Window {
+				n++
+			}
+		}
+		if n >= caps[i].N {
+			return &caps[i]
+		}
+	}
+	return nil
+}
+
+//Record remembers a send of key, caps tell how long it is needed
+func (l *Limiter) Record(key string, caps []Cap) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, c := range caps {
+		if c.Window > l.longest {
+			l.longest = c.Window
+		}
+	}
+	now := l.now()
+	l.sends[key] = append(l.prune(l.sends[key], now), now)
+	if l.records++; l.records%sweepEvery == 0 {
+		for k, v := range l.sends {
+			if v = l.prune(v, now); len(v) == 0 {
+				delete(l.sends, k)
+			} else {
+				l.sends[k] = v
+			}
+		}
+	}
+}
+
+//Len returns the number of keys with recent sends
+func (l *Limiter) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.sends)
+}
+
+//prune drops sends older than the longest window, sends are in order
+func (l *Limiter) prune(sends []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(sends) && now.Sub(sends[i]) >= l.longest {
+		i++
+	}
+	return sends[i:]
+}
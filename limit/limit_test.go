@@ -0,0 +1,57 @@
+package limit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCaps(t *testing.T) {
+	caps, err := ParseCaps("1/30m, 3/24h")
+	assert.NoError(t, err)
+	assert.Equal(t, []Cap{{1, 30 * time.Minute}, {3, 24 * time.Hour}}, caps)
+	assert.Equal(t, "1/30m0s", caps[0].String())
+
+	caps, err = ParseCaps(Off)
+	assert.NoError(t, err)
+	assert.Nil(t, caps)
+	caps, err = ParseCaps("")
+	assert.NoError(t, err)
+	assert.Nil(t, caps)
+
+	for _, s := range []string{"1", "a/1m", "-1/1m", "1/x", "1/0s", "1/30m,"} {
+		_, err = ParseCaps(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	caps := []Cap{{1, 30 * time.Minute}, {3, 24 * time.Hour}}
+
+	assert.Nil(t, l.Allow("782:13800138000", caps))
+	l.Record("782:13800138000", caps)
+	assert.Equal(t, &caps[0], l.Allow("782:13800138000", caps))
+	assert.Nil(t, l.Allow("782:13900139000", caps))
+	assert.Nil(t, l.Allow("782:13800138000", nil))
+
+	for i := 0; i < 2; i++ {
+		now = now.Add(30 * time.Minute)
+		assert.Nil(t, l.Allow("782:13800138000", caps))
+		l.Record("782:13800138000", caps)
+	}
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, &caps[1], l.Allow("782:13800138000", caps))
+
+	//the first send leaves the day
+	now = now.Add(22*time.Hour + 30*time.Minute)
+	assert.Nil(t, l.Allow("782:13800138000", caps))
+
+	now = now.Add(24 * time.Hour)
+	for i := 0; i < sweepEvery-3; i++ {
+		l.Record("other", caps)
+	}
+	assert.Equal(t, 1, l.Len())
+}
@@ -1,19 +1,34 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	log "github.com/alecthomas/log4go"
 	"icsoclib/rabbitmq"
+	"net/http"
+	"os"
+	"os/signal"
+	"sx/broker"
+	"sx/carrier"
 	"sx/config"
+	_ "sx/provider/httpsms"
+	_ "sx/provider/shanxin"
 	"sx/push"
+	"sx/redact"
+	"sx/rule"
+	"sx/seqid"
+	"syscall"
+	"time"
 )
 
 var (
 	confFile string
+	dryRun   bool
 )
 
 func init() {
 	flag.StringVar(&confFile, "conf", "./conf.yml", " set config file path")
+	flag.BoolVar(&dryRun, "dryrun", false, " build and log payloads without posting them")
 }
 
 func main() {
@@ -25,24 +40,137 @@ func main() {
 	if err := conf.Read(confFile); err != nil {
 		panic(err)
 	}
+	redact.Add(conf.Secrets()...)
+	redact.Install(log.Global)
+	if dryRun {
+		conf.DryRun = true
+	}
 	log.Debug("%+v", conf)
 
-	w, err := config.NewWatcher(conf.EtcdURL, conf)
+	if len(conf.Segments) > 0 {
+		if err := carrier.Load(conf.Segments); err != nil {
+			panic(err)
+		}
+	}
+	if args := flag.Args(); len(args) > 0 {
+		if err := command(conf, args); err != nil {
+			log.Error(err)
+			log.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	if len(conf.Segments) > 0 {
+		go reloadSegments(conf.Segments)
+	}
+
+	release, err := claimNode(conf)
 	if err != nil {
 		panic(err)
 	}
-	go w.Watch(conf.PrefixDir)
-
+	defer release()
 	t, err := push.NewPusher(conf)
 	if err != nil {
 		panic(err)
 	}
+	defer t.Close()
+	go t.RunDeferred(nil)
+	go t.RunLedger(nil)
+	go t.RunQuota(nil)
+	bound := conf.GetRules().RoutingKeys()
 	consumer := rabbitmq.NewRabbitmqConsumer(
 		conf.RabbitmqAddrs,
 		conf.Exchange, "topic",
 		conf.QueueName,
-		conf.RoutingKey,
+		bound,
 		rabbitmq.HandlerV2(t.ReadMsg))
 	defer consumer.Close()
+
+	//bind routing keys of rules added at runtime, unbinding needs a restart
+	bindings := broker.NewBindings(consumer, bound)
+	go bindings.Run(time.Second, nil)
+	conf.NotifyRules(func(s rule.Set) {
+		bindings.Add(s.RoutingKeys()...)
+	})
+
+	w, err := config.NewWatcher(conf.EtcdURL, conf)
+	if err != nil {
+		panic(err)
+	}
+	go w.Watch(conf.PrefixDir)
+	if len(conf.RuleKey) > 0 {
+		go w.WatchRules(conf.RuleKey)
+	}
+	if len(conf.BlockDir) > 0 {
+		go w.WatchBlocklist(conf.BlockDir)
+	}
+	if len(conf.AdminAddr) > 0 {
+		allow, err := push.ParseAllow(conf.AdminAllow)
+		if err != nil {
+			panic(err)
+		}
+		go serveAdmin(conf.AdminAddr, push.Guard{Token: conf.AdminToken, Allow: allow}, t, w)
+	}
+	if len(conf.DLRAddr) > 0 {
+		allow, err := push.ParseAllow(conf.DLRAllow)
+		if err != nil {
+			panic(err)
+		}
+		go t.RunReports(nil)
+		go serveReports(conf.DLRAddr, push.Guard{Token: conf.DLRToken, Allow: allow}, t)
+	}
 	consumer.Process()
 }
+
+//serveAdmin serves the admin endpoints of t and the expvar counters
+//behind g, blocklist changes are written to etcd through w
+func serveAdmin(addr string, g push.Guard, t *push.Push, w *config.Watcher) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	t.Handle(mux, w)
+	log.Error(http.ListenAndServe(addr, g.Wrap(mux)))
+}
+
+//claimNode sets the node of the Sequenceids, claiming one in etcd if
+//not configured. release frees the claimed node.
+func claimNode(conf *config.Config) (release func(), err error) {
+	if conf.SeqNode >= 0 {
+		return func() {}, seqid.SetNode(conf.SeqNode)
+	}
+	l, err := seqid.Claim(conf.EtcdURL, conf.SeqNodeDir, conf.SeqNodeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err = seqid.SetNode(l.Node()); err != nil {
+		l.Close()
+		return nil, err
+	}
+	log.Info("seqid node %d claimed", l.Node())
+	done := make(chan struct{})
+	go l.Keep(seqid.SetNode, done)
+	return func() {
+		close(done)
+		l.Close()
+	}, nil
+}
+
+//serveReports takes the delivery reports pushed by the providers behind
+//g, apart from the admin endpoints as the providers reach it
+func serveReports(addr string, g push.Guard, t *push.Push) {
+	mux := http.NewServeMux()
+	t.HandleReports(mux)
+	log.Error(http.ListenAndServe(addr, g.Wrap(mux)))
+}
+
+//reloadSegments reloads the carrier segment file on SIGHUP
+func reloadSegments(file string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		if err := carrier.Load(file); err != nil {
+			log.Error(err)
+			continue
+		}
+		log.Info("carrier segments reloaded, %s", file)
+	}
+}
@@ -0,0 +1,153 @@
+package param
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sx/rule"
+	"time"
+)
+
+//UserData is the MSG field holding the custom data of a call
+const UserData = "user_data"
+
+//Param is one template argument, written as
+//  path[|formatter][=default]
+//path is a MSG field name or a dotted path into nested objects, ie:
+//user_data.name. A bare name missing in MSG is looked up in user_data.
+//An empty path with a default is a literal, ie: =hello
+type Param struct {
+	Path     []string
+	Format   string
+	Default  string
+	Optional bool //has a default value
+}
+
+//MissingError is returned when a required argument is not in the event
+type MissingError struct {
+	Name string
+}
+
+func (e *MissingError) Error() string {
+	return "missing template argument " + e.Name
+}
+
+//Formatter converts a raw field value
+type Formatter func(v string) (string, error)
+
+var formatters = map[string]Formatter{
+	"datetime": unixFormatter("2006-01-02 15:04:05"),
+	"date":     unixFormatter("2006-01-02"),
+	"time":     unixFormatter("15:04:05"),
+}
+
+//Register adds a formatter, it is not safe to call after Parse is used
+func Register(name string, f Formatter) {
+	formatters[name] = f
+}
+
+func unixFormatter(layout string) Formatter {
+	return func(v string) (string, error) {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("not unix time %q", v)
+		}
+		return time.Unix(sec, 0).In(time.Local).Format(layout), nil
+	}
+}
+
+//Parse parses a comma separated list of params
+func Parse(spec string) ([]Param, error) {
+	var params []Param
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		var p Param
+		if i := strings.Index(s, "="); i >= 0 {
+			p.Default = s[i+1:]
+			p.Optional = true
+			s = s[:i]
+		}
+		if i := strings.Index(s, "|"); i >= 0 {
+			p.Format = strings.TrimSpace(s[i+1:])
+			s = s[:i]
+			if _, ok := formatters[p.Format]; !ok {
+				return nil, fmt.Errorf("unknown formatter %s", p.Format)
+			}
+		}
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			p.Path = strings.Split(s, ".")
+		} else if !p.Optional {
+			return nil, fmt.Errorf("empty param in %q", spec)
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+//Name returns the param path as written
+func (p *Param) Name() string {
+	return strings.Join(p.Path, ".")
+}
+
+//Resolve returns the value of every param from the MSG of an event
+func Resolve(params []Param, msg map[string]interface{}) ([]string, error) {
+	values := make([]string, 0, len(params))
+	for i := range params {
+		v, err := params[i].resolve(msg)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (p *Param) resolve(msg map[string]interface{}) (string, error) {
+	v, ok := "", false
+	if len(p.Path) > 0 {
+		v, ok = lookup(msg, p.Path)
+		if !ok && len(p.Path) == 1 {
+			v, ok = lookup(msg, []string{UserData, p.Path[0]})
+		}
+	}
+	if ok && len(v) > 0 && len(p.Format) > 0 {
+		var err error
+		if v, err = formatters[p.Format](v); err != nil {
+			if !p.Optional {
+				return "", fmt.Errorf("%s: %s", p.Name(), err.Error())
+			}
+			ok = false
+		}
+	}
+	if !ok || len(v) == 0 {
+		if !p.Optional {
+			return "", &MissingError{Name: p.Name()}
+		}
+		return p.Default, nil
+	}
+	return v, nil
+}
+
+//lookup walks path through nested objects, an object sent as a json
+//string is decoded too
+func lookup(msg map[string]interface{}, path []string) (string, bool) {
+	for _, name := range path[:len(path)-1] {
+		switch t := msg[name].(type) {
+		case map[string]interface{}:
+			msg = t
+		case string:
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(t), &m); err != nil {
+				return "", false
+			}
+			msg = m
+		default:
+			return "", false
+		}
+	}
+	return rule.Field(msg, path[len(path)-1])
+}
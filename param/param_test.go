@@ -0,0 +1,62 @@
+package param
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const d = `{"vcc_id":"782","called":"15201164261","start_time":"1555037834","status":"1",
+"user_data":{"ClientName":"icsoc","order":{"id":12345}},"raw":"{\"name\":\"bob\"}"}`
+
+func msg(t *testing.T) map[string]interface{} {
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(d), &m))
+	return m
+}
+
+func TestParse(t *testing.T) {
+	params, err := Parse("called, user_data.order.id, start_time|date=unknown, =literal")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(params))
+	assert.Equal(t, []string{"user_data", "order", "id"}, params[1].Path)
+	assert.Equal(t, "date", params[2].Format)
+	assert.Equal(t, "unknown", params[2].Default)
+	assert.True(t, params[2].Optional)
+	assert.Nil(t, params[3].Path)
+	assert.Equal(t, "literal", params[3].Default)
+
+	_, err = Parse("start_time|nope")
+	assert.Error(t, err)
+	_, err = Parse("called,|date")
+	assert.Error(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	params, err := Parse("ClientName,user_data.order.id,raw.name,start_time|datetime,missing=-,=hi")
+	assert.NoError(t, err)
+	values, err := Resolve(params, msg(t))
+	assert.NoError(t, err)
+	start := time.Unix(1555037834, 0).Format("2006-01-02 15:04:05")
+	assert.Equal(t, []string{"icsoc", "12345", "bob", start, "-", "hi"}, values)
+}
+
+func TestResolveMissing(t *testing.T) {
+	params, err := Parse("called,user_data.agent")
+	assert.NoError(t, err)
+	_, err = Resolve(params, msg(t))
+	assert.Equal(t, &MissingError{Name: "user_data.agent"}, err)
+
+	params, err = Parse("status|datetime")
+	assert.NoError(t, err)
+	values, err := Resolve(params, map[string]interface{}{"status": "x"})
+	assert.Error(t, err)
+	assert.Nil(t, values)
+
+	params, err = Parse("status|datetime=")
+	assert.NoError(t, err)
+	values, err = Resolve(params, map[string]interface{}{"status": "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, values)
+}
@@ -0,0 +1,132 @@
+package phone
+
+import (
+	"strings"
+)
+
+//Reason is why a number is not a mobile
+type Reason string
+
+const (
+	Empty         Reason = "empty"
+	BadChar       Reason = "bad_char"
+	International Reason = "international"
+	Landline      Reason = "landline"
+	Service       Reason = "service" //short codes, 95xxx, 400/800
+	NotMobile     Reason = "not_mobile"
+	TooShort      Reason = "too_short"
+	TooLong       Reason = "too_long"
+)
+
+//RejectError is returned for a number that can't be flashed
+type RejectError struct {
+	Input  string
+	Reason Reason
+}
+
+func (e *RejectError) Error() string {
+	return string(e.Reason) + ": " + e.Input
+}
+
+func reject(input string, r Reason) (string, error) {
+	return "", &RejectError{Input: input, Reason: r}
+}
+
+//extension marks the end of the number, the rest are digits dialed by
+//the IVR, ie: 13800138000#123, 13800138000,8001
+const extension = "#,;*pPwWxX转"
+
+//separators may appear anywhere in a number
+const separators = " \t-.()（）　"
+
+//indexFold is strings.Index of the lower case ASCII sub in s ignoring
+//ASCII case, the index is of s itself whatever else s holds
+func indexFold(s, sub string) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		j := 0
+		for ; j < len(sub); j++ {
+			c := s[i+j]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != sub[j] {
+				break
+			}
+		}
+		if j == len(sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+//Normalize returns the 11 digits mobile of a number the switch emits,
+//it accepts +86, 0086 and 86 country prefixes, a leading trunk 0,
+//separators and an IVR extension
+func Normalize(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if i := indexFold(s, "ext"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexAny(s, extension); i >= 0 {
+		s = s[:i]
+	}
+	plus := false
+	digits := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r == '+' && len(digits) == 0 && !plus:
+			plus = true
+		case strings.ContainsRune(separators, r):
+		default:
+			return reject(raw, BadChar)
+		}
+	}
+	d := string(digits)
+	if len(d) == 0 {
+		return reject(raw, Empty)
+	}
+
+	switch {
+	case plus && !strings.HasPrefix(d, "86"):
+		return reject(raw, International)
+	case plus:
+		d = d[2:]
+	case strings.HasPrefix(d, "0086"):
+		d = d[4:]
+	case strings.HasPrefix(d, "00"):
+		return reject(raw, International)
+	case len(d) == 13 && strings.HasPrefix(d, "861"):
+		d = d[2:]
+	}
+	//trunk prefix of a mobile
+	if len(d) == 12 && d[0] == '0' && d[1] == '1' && d[2] >= '3' {
+		d = d[1:]
+	}
+
+	switch {
+	case len(d) == 0:
+		return reject(raw, TooShort)
+	case d[0] == '0':
+		if len(d) < 10 {
+			return reject(raw, TooShort)
+		}
+		return reject(raw, Landline)
+	case len(d) == 11:
+		if d[0] == '1' && d[1] >= '3' {
+			return d, nil
+		}
+		return reject(raw, NotMobile)
+	case len(d) > 11:
+		return reject(raw, TooLong)
+	case len(d) >= 3 && len(d) <= 6 && (d[0] == '1' || d[0] == '9'):
+		return reject(raw, Service)
+	case len(d) == 10 && (strings.HasPrefix(d, "400") || strings.HasPrefix(d, "800")):
+		return reject(raw, Service)
+	case len(d) >= 7 && len(d) <= 8 && d[0] >= '2':
+		return reject(raw, Landline)
+	}
+	return reject(raw, TooShort)
+}
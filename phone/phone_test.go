@@ -0,0 +1,94 @@
+package phone
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	ok := map[string]string{
+		"13800138000":           "13800138000",
+		" 13800138000 ":         "13800138000",
+		"013800138000":          "13800138000",
+		"+8613800138000":        "13800138000",
+		"+86 138 0013 8000":     "13800138000",
+		"008613800138000":       "13800138000",
+		"8613800138000":         "13800138000",
+		"138-0013-8000":         "13800138000",
+		"(+86)138.0013.8000":    "13800138000",
+		"13800138000#123":       "13800138000",
+		"13800138000,8001":      "13800138000",
+		"13800138000 ext. 8001": "13800138000",
+		"13800138000 EXT 8001":  "13800138000",
+		"19912345678":           "19912345678",
+	}
+	for in, want := range ok {
+		got, err := Normalize(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	rejected := map[string]Reason{
+		"":               Empty,
+		"  ":             Empty,
+		"#123":           Empty,
+		"123456789a0":    BadChar,
+		"138+00138000":   BadChar,
+		"+1 4155550100":  International,
+		"0014155550100":  International,
+		"01012345678":    Landline,
+		"010-12345678":   Landline,
+		"0571 87654321":  Landline,
+		"59658059":       Landline,
+		"10086":          Service,
+		"95555":          Service,
+		"110":            Service,
+		"4008123123":     Service,
+		"12345678900":    NotMobile,
+		"010345678900":   Landline,
+		"123456789000":   TooLong,
+		"0103456789000":  Landline,
+		"138001380001":   TooLong,
+		"1380013":        TooShort,
+		"12":             TooShort,
+		"0":              TooShort,
+		"+86":            TooShort,
+		"86138001380000": TooLong,
+		"ȺȺȺȺext":        BadChar,
+		"\xff\xffext":    BadChar,
+	}
+	for in, want := range rejected {
+		_, err := Normalize(in)
+		if assert.Error(t, err, in) {
+			assert.Equal(t, want, err.(*RejectError).Reason, in)
+			assert.Equal(t, in, err.(*RejectError).Input, in)
+		}
+	}
+}
+
+func FuzzNormalize(f *testing.F) {
+	for _, s := range []string{"13800138000", "+86 138-0013-8000", "0086138001380000#1", "010-12345678", "95555", "+", "转", "ȺȺȺȺext", "\xff\xffext"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		got, err := Normalize(in)
+		if err != nil {
+			if _, ok := err.(*RejectError); !ok {
+				t.Fatalf("%q: untyped error %v", in, err)
+			}
+			return
+		}
+		if len(got) != 11 || got[0] != '1' || got[1] < '3' {
+			t.Fatalf("%q: not a mobile %q", in, got)
+		}
+		for i := 0; i < len(got); i++ {
+			if got[i] < '0' || got[i] > '9' {
+				t.Fatalf("%q: not a mobile %q", in, got)
+			}
+		}
+		//canonical form is a fixed point
+		if again, err := Normalize(got); err != nil || again != got {
+			t.Fatalf("%q: %q normalizes to %q, %v", in, got, again, err)
+		}
+	})
+}
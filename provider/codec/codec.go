@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//Tag is the struct tag telling how a field goes on the wire, every
+//exported field of a payload has one so that a field added later is
+//never sent in clear, or encrypted, by accident
+const Tag = "sx"
+
+//Values of Tag
+const (
+	Encrypt = "encrypt" //a string field run through the Func
+	Plain   = "plain"   //left as is
+)
+
+//Func transforms the value of an encrypted field, ie: encrypts it
+type Func func(v string) (string, error)
+
+//plan is the encrypted fields of a type
+type plan struct {
+	fields []int
+	names  []string
+	err    error
+}
+
+var plans sync.Map //reflect.Type to *plan
+
+//Apply runs f on every non empty encrypted field of v, a pointer to a
+//struct, in place
+func Apply(v interface{}, f Func) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("codec: %T is not a pointer to a struct", v)
+	}
+	rv = rv.Elem()
+	p := planOf(rv.Type())
+	if p.err != nil {
+		return p.err
+	}
+	for i, idx := range p.fields {
+		fv := rv.Field(idx)
+		s := fv.String()
+		if len(s) == 0 {
+			continue
+		}
+		enc, err := f(s)
+		if err != nil {
+			return fmt.Errorf("codec: field %s, %s", p.names[i], err.Error())
+		}
+		fv.SetString(enc)
+	}
+	return nil
+}
+
+//Check reports whether the type of v, a pointer to a struct, is
+//properly tagged
+func Check(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("codec: %T is not a pointer to a struct", v)
+	}
+	return planOf(t.Elem()).err
+}
+
+func planOf(t reflect.Type) *plan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*plan)
+	}
+	p := build(t)
+	plans.Store(t, p)
+	return p
+}
+
+func build(t reflect.Type) *plan {
+	p := &plan{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		switch tag := sf.Tag.Get(Tag); tag {
+		case Encrypt:
+			if sf.Type.Kind() != reflect.String {
+				return &plan{err: fmt.Errorf("codec: %s.%s is %s, only strings are encrypted", t.Name(), sf.Name, sf.Type)}
+			}
+			p.fields = append(p.fields, i)
+			p.names = append(p.names, sf.Name)
+		case Plain:
+		case "":
+			return &plan{err: fmt.Errorf("codec: %s.%s has no %s tag", t.Name(), sf.Name, Tag)}
+		default:
+			return &plan{err: fmt.Errorf("codec: %s.%s tag %s:%q, want %s or %s", t.Name(), sf.Name, Tag, tag, Encrypt, Plain)}
+		}
+	}
+	return p
+}
@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type payload struct {
+	Mobile  string `json:"mobile" sx:"encrypt"`
+	MsgType string `json:"msgType" sx:"plain"`
+	Count   int    `json:"count" sx:"plain"`
+	Args    string `json:"args" sx:"encrypt"`
+	secret  string
+}
+
+func upper(v string) (string, error) {
+	return strings.ToUpper(v), nil
+}
+
+func TestApply(t *testing.T) {
+	p := &payload{Mobile: "abc", MsgType: "four", Count: 2, secret: "x"}
+	assert.NoError(t, Check(p))
+	assert.NoError(t, Apply(p, upper))
+	assert.Equal(t, payload{Mobile: "ABC", MsgType: "four", Count: 2, secret: "x"}, *p)
+
+	err := Apply(&payload{Args: "a"}, func(string) (string, error) { return "", errors.New("bad key") })
+	assert.EqualError(t, err, "codec: field Args, bad key")
+
+	assert.Error(t, Apply(payload{}, upper))
+	assert.Error(t, Check(payload{}))
+
+	var untagged struct {
+		A string `sx:"encrypt"`
+		B string
+	}
+	assert.EqualError(t, Apply(&untagged, upper), "codec: .B has no sx tag")
+	var notString struct {
+		N int `sx:"encrypt"`
+	}
+	assert.Error(t, Check(&notString))
+	var typo struct {
+		A string `sx:"encrypted"`
+	}
+	assert.Error(t, Apply(&typo, upper))
+}
@@ -0,0 +1,139 @@
+package httpsms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sx/carrier"
+	"sx/config"
+	"sx/provider"
+	"sx/seqid"
+	"time"
+)
+
+//codeOK is the code of an accepted request
+const codeOK = "0"
+
+func init() {
+	provider.Register("httpsms", New)
+}
+
+//Message is the json body posted to the gateway
+type Message struct {
+	Account    string `json:"account"`
+	Password   string `json:"password"`
+	Mobile     string `json:"mobile"`
+	Content    string `json:"content"`
+	Sign       string `json:"sign,omitempty"`
+	Sequenceid string `json:"sequenceid"`
+}
+
+//Result is the json answer of the gateway
+type Result struct {
+	Code string `json:"code"`
+	Desc string `json:"desc"`
+}
+
+//HTTPSms sends ordinary sms through a json over http gateway, it
+//reaches every carrier. Enterid and Enterpass of the provider config
+//are the account, Caller is the signature.
+type HTTPSms struct {
+	name     string
+	url      string
+	account  string
+	password string
+	sign     string
+	*http.Client
+}
+
+//New creates a HTTPSms provider
+func New(name string, conf *config.ProviderConf) (provider.Provider, error) {
+	if len(conf.URL) == 0 {
+		return nil, fmt.Errorf("provider %s: url empty", name)
+	}
+	return &HTTPSms{
+		name:     name,
+		url:      conf.URL,
+		account:  conf.Enterid,
+		password: conf.Enterpass,
+		sign:     conf.Caller,
+		Client:   &http.Client{Timeout: time.Second * 3},
+	}, nil
+}
+
+func (h *HTTPSms) Name() string {
+	return h.name
+}
+
+func (h *HTTPSms) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Carriers: carrier.Mobile.Bit() | carrier.Unicom.Bit() | carrier.Telecom.Bit() | carrier.Virtual.Bit(),
+		Text:     true,
+	}
+}
+
+//Send posts the text of req, flash requests are refused
+func (h *HTTPSms) Send(req *provider.Request) (*provider.Response, error) {
+	if len(req.Text) == 0 {
+		return nil, fmt.Errorf("provider %s: only ordinary sms supported", h.name)
+	}
+	if len(req.Sequenceid) == 0 {
+		req.Sequenceid = seqid.Next()
+	}
+	m := &Message{
+		Account:    h.account,
+		Password:   h.password,
+		Mobile:     req.Mobile,
+		Content:    req.Text,
+		Sign:       h.sign,
+		Sequenceid: req.Sequenceid,
+	}
+	if req.DryRun {
+		r := *m
+		r.Account, r.Password = provider.Redacted, provider.Redacted
+		buf, _ := json.Marshal(&r)
+		log.Info("dry run provider %s, url %s, %s", h.name, h.url, string(buf))
+		return &provider.Response{Code: codeOK, Desc: provider.DryRunDesc, Sequenceid: req.Sequenceid}, nil
+	}
+	buf, _ := json.Marshal(m)
+	resp, err := h.Post(h.url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &provider.StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	var res Result
+	if err = json.Unmarshal(data, &res); err != nil {
+		log.Error("%s, %s", err.Error(), string(data))
+		return nil, err
+	}
+	r := &provider.Response{Code: res.Code, Desc: res.Desc, Sequenceid: req.Sequenceid}
+	if res.Code != codeOK {
+		return r, fmt.Errorf("%+v", res)
+	}
+	return r, nil
+}
+
+//Classify network errors, 5xx and 429 are retryable
+func (h *HTTPSms) Classify(resp *provider.Response, err error) provider.Outcome {
+	if err == nil {
+		return provider.Success
+	}
+	if e, ok := err.(*provider.StatusError); ok {
+		if e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests {
+			return provider.Retryable
+		}
+		return provider.Permanent
+	}
+	if _, ok := err.(net.Error); ok {
+		return provider.Retryable
+	}
+	return provider.Permanent
+}
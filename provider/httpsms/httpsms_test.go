@@ -0,0 +1,50 @@
+package httpsms
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sx/config"
+	"sx/provider"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	var got Message
+	code := "0"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Write([]byte(`{"code":"` + code + `","desc":"x"}`))
+	}))
+	defer ts.Close()
+
+	p, err := New("text", &config.ProviderConf{Type: "httpsms", URL: ts.URL, Enterid: "acc", Enterpass: "pw", Caller: "icsoc"})
+	assert.NoError(t, err)
+	assert.True(t, p.Capabilities().Text)
+	assert.False(t, p.Capabilities().Flash)
+
+	resp, err := p.Send(&provider.Request{Mobile: "13300000000", Text: "hello", Sequenceid: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", resp.Sequenceid)
+	assert.Equal(t, Message{Account: "acc", Password: "pw", Mobile: "13300000000", Content: "hello", Sign: "icsoc", Sequenceid: "1"}, got)
+
+	got = Message{}
+	resp, err = p.Send(&provider.Request{Mobile: "13300000000", Text: "hello", Sequenceid: "2", DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, provider.DryRunDesc, resp.Desc)
+	assert.Equal(t, "2", resp.Sequenceid)
+	assert.Equal(t, Message{}, got)
+
+	code = "17"
+	resp, err = p.Send(&provider.Request{Mobile: "13300000000", Text: "hello"})
+	assert.Error(t, err)
+	assert.Equal(t, "17", resp.Code)
+	assert.Equal(t, provider.Permanent, p.Classify(resp, err))
+
+	_, err = p.Send(&provider.Request{Mobile: "13300000000", Args: []string{"a"}})
+	assert.Error(t, err)
+
+	_, err = New("text", &config.ProviderConf{Type: "httpsms"})
+	assert.Error(t, err)
+}
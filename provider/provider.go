@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sx/config"
+	"sx/dlr"
+)
+
+//Outcome classifies the result of a send
+type Outcome int
+
+const (
+	Success   Outcome = iota
+	Retryable         //timeout, 5xx and alike, the same request may succeed later
+	Permanent         //rejected by the provider, resending won't help
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Success:
+		return "success"
+	case Retryable:
+		return "retryable"
+	}
+	return "permanent"
+}
+
+//Request is one message to a mobile
+type Request struct {
+	Mobile     string
+	Sequenceid string
+	Tempid     string
+	Args       []string //template arguments, joined the way the provider wants
+	Text       string   //content of an ordinary sms, flash requests leave it empty
+	DryRun     bool     //build and log the payload without posting, the send succeeds
+}
+
+//Redacted replaces credentials in logged payloads
+const Redacted = "***"
+
+//DryRunDesc is the Desc of the synthetic response of a dry run
+const DryRunDesc = "dry run"
+
+//Response is what the provider answered
+type Response struct {
+	Code       string
+	Desc       string
+	Sequenceid string
+}
+
+//Capabilities tells what a provider can deliver
+type Capabilities struct {
+	Carriers int //mask of carrier.Carrier networks reached
+	Flash    bool
+	Text     bool //ordinary sms
+}
+
+//Provider sends messages through one sms gateway
+type Provider interface {
+	Name() string
+	Capabilities() Capabilities
+	//Send returns a non nil error unless the provider accepted the request
+	Send(req *Request) (*Response, error)
+	//Classify tells whether a failed Send is worth retrying
+	Classify(resp *Response, err error) Outcome
+}
+
+//Reporter is a provider pushing delivery reports over http
+type Reporter interface {
+	//Reports decodes the body of a push
+	Reports(body []byte) ([]dlr.Report, error)
+	//Ack is the body answering a push, err is why it was refused
+	Ack(err error) []byte
+}
+
+//Factory creates a provider named name
+type Factory func(name string, conf *config.ProviderConf) (Provider, error)
+
+var factories = make(map[string]Factory)
+
+//Register makes a provider type available, called from init of the
+//implementation package
+func Register(typ string, f Factory) {
+	if _, ok := factories[typ]; ok {
+		panic("provider type registered twice: " + typ)
+	}
+	factories[typ] = f
+}
+
+//New creates a provider by its configured type
+func New(name string, conf *config.ProviderConf) (Provider, error) {
+	f, ok := factories[conf.Type]
+	if !ok {
+		return nil, fmt.Errorf("provider %s: unknown type %q, known %v", name, conf.Type, types())
+	}
+	return f(name, conf)
+}
+
+func types() []string {
+	var s []string
+	for k := range factories {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+//StatusError is a non 2xx http status from a provider
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status %d, %s", e.StatusCode, e.Body)
+}
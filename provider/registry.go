@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"fmt"
+	"sx/config"
+)
+
+//Registry holds the configured providers
+type Registry struct {
+	providers map[string]Provider
+	smsconf   map[int]string
+	def       string
+}
+
+//NewRegistry creates every provider of conf
+func NewRegistry(conf *config.Config) (*Registry, error) {
+	r := &Registry{
+		providers: make(map[string]Provider, len(conf.Providers)),
+		smsconf:   conf.Smsconf,
+		def:       conf.DefaultProvider,
+	}
+	for name, pc := range conf.Providers {
+		p, err := New(name, pc)
+		if err != nil {
+			return nil, err
+		}
+		r.providers[name] = p
+	}
+	if _, ok := r.providers[r.def]; !ok {
+		return nil, fmt.Errorf("default provider %q not configured", r.def)
+	}
+	for id, name := range r.smsconf {
+		if _, ok := r.providers[name]; !ok {
+			return nil, fmt.Errorf("smsconf %d: provider %q not configured", id, name)
+		}
+	}
+	return r, nil
+}
+
+//Get returns the provider named name
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+//Pick returns the provider of a FlashSMS.Smsconf, the default provider
+//if smsconf is not mapped
+func (r *Registry) Pick(smsconf int) Provider {
+	if name, ok := r.smsconf[smsconf]; ok {
+		return r.providers[name]
+	}
+	return r.providers[r.def]
+}
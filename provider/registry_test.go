@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sx/config"
+	"testing"
+)
+
+type fake struct {
+	name string
+}
+
+func (f *fake) Name() string                              { return f.name }
+func (f *fake) Capabilities() Capabilities                { return Capabilities{Flash: true} }
+func (f *fake) Send(req *Request) (*Response, error)      { return &Response{}, nil }
+func (f *fake) Classify(resp *Response, err error) Outcome { return Success }
+
+func init() {
+	Register("fake", func(name string, conf *config.ProviderConf) (Provider, error) {
+		return &fake{name: name}, nil
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	conf := config.NewConfig()
+	conf.Providers = map[string]*config.ProviderConf{
+		"a": {Type: "fake"},
+		"b": {Type: "fake"},
+	}
+	conf.DefaultProvider = "a"
+	conf.Smsconf = map[int]string{2: "b"}
+	r, err := NewRegistry(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", r.Pick(0).Name())
+	assert.Equal(t, "a", r.Pick(1).Name())
+	assert.Equal(t, "b", r.Pick(2).Name())
+	p, ok := r.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, "b", p.Name())
+
+	conf.Smsconf = map[int]string{2: "c"}
+	_, err = NewRegistry(conf)
+	assert.Error(t, err)
+
+	conf.Smsconf = nil
+	conf.DefaultProvider = "c"
+	_, err = NewRegistry(conf)
+	assert.Error(t, err)
+
+	conf.DefaultProvider = "a"
+	conf.Providers["c"] = &config.ProviderConf{Type: "nope"}
+	_, err = NewRegistry(conf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package shanxin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"sx/encrypt"
+	"sx/provider"
+	"sx/provider/codec"
+	"testing"
+)
+
+//{Mobile:4IivQaPDhFuw6uVsR8FGpA== Operid:EM+/PKF5bfExfRfrM4yg1A== Caller:IcJI36+GeV7XgUHB6ZRoug== Sequenceid:4pCrAQH+RZ/Xl2Wn8bkJFnsoDfW4lxj3bW2y3sQVdLA= Tempid:f9i8Ai7hXJKoXj2wEtO/QQ== Enterid:Fh0B
+//W4NMhDRhlGfzKnm83w== Enterpass:UubM9ajIurxg8MJtdLi4oQ== Args:y2g4uObdVTWleEmHT5eBDg== MsgType:Ifd8TlqL1SHYrF9YsSkzyQ==}
+//
+//{Mobile:Q8WxAJTl1dQGEyjY0nOX6w== Operid:EM+/PKF5bfExfRfrM4yg1A== Caller:IcJI36+GeV7XgUHB6ZRoug== Sequenceid:yTjbCOdbTcJ5ZWYEPHnfFozWEuEqk2C0KsNkIa6alK8= Tempid:f9i8Ai7hXJKoXj2wEtO/QQ== Enterid:Fh0B
+//W4NMhDRhlGfzKnm83w== Enterpass:UubM9ajIurxg8MJtdLi4oQ== Args:y2g4uObdVTWleEmHT5eBDg== MsgType:Ifd8TlqL1SHYrF9YsSkzyQ==}
+
+//publishReflect is the loop publish ran before the codec, every field
+//encrypted with a cipher built for each
+func publishReflect(m *SxMessage, key string) error {
+	value := reflect.ValueOf(m).Elem()
+	l := value.NumField()
+	for i := 0; i < l; i++ {
+		v := value.Field(i).String()
+		if len(v) > 0 {
+			enc, err := encrypt.AESBase64Encrypt(v, key)
+			if err != nil {
+				return err
+			}
+			value.Field(i).SetString(enc)
+		}
+	}
+	return nil
+}
+
+func benchMessage(b *testing.B) (*Shanxin, *provider.Request) {
+	p, err := New("shanxin", testConf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return p.(*Shanxin), &provider.Request{Mobile: "18627826073", Args: []string{"ClientName"}, Sequenceid: "2026101708301512300070001"}
+}
+
+func BenchmarkPublishReflect(b *testing.B) {
+	s, req := benchMessage(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := publishReflect(s.message(req), testConf.Key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPublish(b *testing.B) {
+	s, req := benchMessage(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := codec.Apply(s.message(req), s.enc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPublishCodec(t *testing.T) {
+	s, err := New("shanxin", testConf)
+	assert.NoError(t, err)
+	req := &provider.Request{Mobile: "18627826073", Args: []string{"ClientName"}, Sequenceid: "2026101708301512300070001"}
+	want, got := s.(*Shanxin).message(req), s.(*Shanxin).message(req)
+	assert.NoError(t, publishReflect(want, "hg62159393"))
+	assert.NoError(t, codec.Apply(got, s.(*Shanxin).enc))
+	assert.Equal(t, want, got)
+	assert.NoError(t, codec.Check(&SxReport{}))
+}
\ No newline at end of file
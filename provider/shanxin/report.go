@@ -0,0 +1,84 @@
+package shanxin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sx/dlr"
+	"sx/provider/codec"
+	"time"
+)
+
+//statusDelivered and statusExpired are the report statuses that aren't
+//failures
+const (
+	statusDelivered = "DELIVRD"
+	statusExpired   = "EXPIRED"
+)
+
+//SxReport is a delivery report, encrypted field by field like SxMessage.
+//A push holds one report or an array of them.
+type SxReport struct {
+	Sequenceid string `json:"sequenceid" sx:"encrypt"`
+	Mobile     string `json:"mobile" sx:"encrypt"`
+	Status     string `json:"status" sx:"encrypt"`
+	Desc       string `json:"desc" sx:"encrypt"`
+	Time       string `json:"time" sx:"encrypt"` //yyyyMMddHHmmss, Beijing time
+}
+
+//reportTime is the zone of SxReport.Time
+var reportTime = time.FixedZone("CST", 8*3600)
+
+//Reports decrypts the reports of a push
+func (s *Shanxin) Reports(body []byte) ([]dlr.Report, error) {
+	var reps []SxReport
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		reps = make([]SxReport, 1)
+		if err := json.Unmarshal(body, &reps[0]); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(body, &reps); err != nil {
+		return nil, err
+	}
+
+	reports := make([]dlr.Report, 0, len(reps))
+	for i := range reps {
+		r := &reps[i]
+		if err := codec.Apply(r, s.c.Decrypt); err != nil {
+			return nil, fmt.Errorf("provider %s report %d: %s", s.name, i, err.Error())
+		}
+		if len(r.Sequenceid) == 0 {
+			return nil, fmt.Errorf("provider %s report %d: sequenceid empty", s.name, i)
+		}
+		rep := dlr.Report{Sequenceid: r.Sequenceid, Mobile: r.Mobile, State: dlr.Failed, Desc: r.Status}
+		switch r.Status {
+		case statusDelivered:
+			rep.State = dlr.Delivered
+		case statusExpired:
+			rep.State = dlr.Expired
+		}
+		if len(r.Desc) > 0 {
+			rep.Desc += ", " + r.Desc
+		}
+		if len(r.Time) > 0 {
+			t, err := time.ParseInLocation("20060102150405", r.Time, reportTime)
+			if err != nil {
+				return nil, fmt.Errorf("provider %s report %d: %s", s.name, i, err.Error())
+			}
+			rep.Time = t
+		}
+		reports = append(reports, rep)
+	}
+	return reports, nil
+}
+
+//Ack answers a push like the send api answers a request
+func (s *Shanxin) Ack(err error) []byte {
+	r := SxResponse{ResultCode: resultOK, ResultDesc: "ok"}
+	if err != nil {
+		r = SxResponse{ResultCode: "400", ResultDesc: err.Error()}
+	}
+	buf, _ := json.Marshal(&r)
+	return buf
+}
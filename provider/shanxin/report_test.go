@@ -0,0 +1,49 @@
+package shanxin
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"sx/dlr"
+	"sx/provider"
+	"testing"
+	"time"
+)
+
+func TestReports(t *testing.T) {
+	p := newShanxin(t, "http://127.0.0.1")
+	r, ok := p.(provider.Reporter)
+	assert.True(t, ok)
+
+	rep := func(seq, status, at string) map[string]string {
+		return map[string]string{
+			"sequenceid": enc(t, seq),
+			"mobile":     enc(t, "18627826073"),
+			"status":     enc(t, status),
+			"time":       enc(t, at),
+		}
+	}
+	body, _ := json.Marshal(rep("1", "DELIVRD", "20261017163015"))
+	reports, err := r.Reports(body)
+	assert.NoError(t, err)
+	assert.Equal(t, []dlr.Report{{
+		Sequenceid: "1",
+		Mobile:     "18627826073",
+		State:      dlr.Delivered,
+		Desc:       "DELIVRD",
+		Time:       time.Date(2026, 10, 17, 8, 30, 15, 0, time.UTC).In(reportTime),
+	}}, reports)
+
+	body, _ = json.Marshal([]map[string]string{rep("2", "EXPIRED", ""), rep("3", "UNDELIV", "")})
+	reports, err = r.Reports(body)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(reports))
+	assert.Equal(t, dlr.Expired, reports[0].State)
+	assert.Equal(t, dlr.Failed, reports[1].State)
+	assert.True(t, reports[1].Time.IsZero())
+
+	for _, body := range []string{``, `{`, `{"sequenceid":"plain"}`, `{"mobile":"` + enc(t, "1") + `"}`} {
+		_, err = r.Reports([]byte(body))
+		assert.Error(t, err, body)
+	}
+	assert.JSONEq(t, `{"resultCode":"200","resultDesc":"ok"}`, string(r.Ack(nil)))
+}
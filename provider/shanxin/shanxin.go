@@ -0,0 +1,214 @@
+package shanxin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sx/carrier"
+	"sx/config"
+	"sx/encrypt"
+	"sx/provider"
+	"sx/provider/codec"
+	"sx/seqid"
+	"time"
+)
+
+//argsSep separates template arguments in SxMessage.Args
+const argsSep = ","
+
+//resultOK is the resultCode of an accepted request
+const resultOK = "200"
+
+//defaultCipher encrypts fields unless the provider configures another
+const defaultCipher = "aes-cbc-zero"
+
+func init() {
+	provider.Register("shanxin", New)
+}
+
+//SxMessage is the request body, every field is encrypted
+type SxMessage struct {
+	Mobile     string `json:"mobile" sx:"encrypt"`
+	Operid     string `json:"operid" sx:"encrypt"`
+	Caller     string `json:"caller" sx:"encrypt"`
+	Sequenceid string `json:"sequenceid" sx:"encrypt"`
+	Tempid     string `json:"tempid" sx:"encrypt"`
+	Enterid    string `json:"enterid" sx:"encrypt"`
+	Enterpass  string `json:"enterpass" sx:"encrypt"`
+	Args       string `json:"args" sx:"encrypt"`
+	MsgType    string `json:"msgType" sx:"encrypt"`
+}
+
+type SxResponse struct {
+	ResultCode string `json:"resultCode"`
+	ResultDesc string `json:"resultDesc"`
+}
+
+//Shanxin sends flash through the Shanxin ussd api, every field of the
+//request is encrypted with the enterprise key, AES-CBC with a zero iv
+//unless another cipher is configured
+type Shanxin struct {
+	name string
+	url  string
+	c    encrypt.Cipher
+	enc  codec.Func
+	SxMessage
+	*http.Client
+}
+
+//New creates a Shanxin provider
+func New(name string, conf *config.ProviderConf) (provider.Provider, error) {
+	if len(conf.URL) == 0 {
+		return nil, fmt.Errorf("provider %s: url empty", name)
+	}
+	cipherName := conf.Cipher
+	if len(cipherName) == 0 {
+		cipherName = defaultCipher
+	}
+	spec, err := encrypt.ParseSpec(cipherName, conf.Padding, conf.Encoding, conf.IV)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %s", name, err.Error())
+	}
+	c, err := encrypt.NewCipher(spec, conf.Key)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %s", name, err.Error())
+	}
+	return &Shanxin{
+		name: name,
+		url:  conf.URL,
+		c:    c,
+		enc:  c.Encrypt,
+		SxMessage: SxMessage{
+			Operid:    conf.Operid,
+			Caller:    conf.Caller,
+			Tempid:    conf.Tempid,
+			Enterid:   conf.Enterid,
+			Enterpass: conf.Enterpass,
+		},
+		Client: &http.Client{Timeout: time.Second * 3},
+	}, nil
+}
+
+func (s *Shanxin) Name() string {
+	return s.name
+}
+
+//Capabilities flash reaches China Mobile and China Unicom only
+func (s *Shanxin) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Carriers: carrier.Mobile.Bit() | carrier.Unicom.Bit(),
+		Flash:    true,
+	}
+}
+
+//Send posts req, the default template is used if req has none
+func (s *Shanxin) Send(req *provider.Request) (*provider.Response, error) {
+	if len(req.Text) > 0 {
+		return nil, fmt.Errorf("provider %s: ordinary sms not supported", s.name)
+	}
+	m := s.message(req)
+	if err := s.publish(m); err != nil {
+		return nil, err
+	}
+	if req.DryRun {
+		return s.dryRun(req, m), nil
+	}
+	buf, _ := json.Marshal(m)
+	resp, err := s.post(buf)
+	if resp != nil {
+		resp.Sequenceid = req.Sequenceid
+	}
+	return resp, err
+}
+
+//dryRun logs the encrypted payload with the credentials redacted
+func (s *Shanxin) dryRun(req *provider.Request, m *SxMessage) *provider.Response {
+	r := *m
+	r.Enterid, r.Enterpass = provider.Redacted, provider.Redacted
+	buf, _ := json.Marshal(&r)
+	log.Info("dry run provider %s, url %s, %s", s.name, s.url, string(buf))
+	return &provider.Response{Code: resultOK, Desc: provider.DryRunDesc, Sequenceid: req.Sequenceid}
+}
+
+//Classify network errors, 5xx and 429 are retryable, anything else,
+//ie: a resultCode other than 200 or an unreadable answer, is permanent
+//so a request the provider may have taken is never sent twice
+func (s *Shanxin) Classify(resp *provider.Response, err error) provider.Outcome {
+	if err == nil {
+		return provider.Success
+	}
+	if e, ok := err.(*provider.StatusError); ok {
+		if e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests {
+			return provider.Retryable
+		}
+		return provider.Permanent
+	}
+	if _, ok := err.(net.Error); ok {
+		return provider.Retryable
+	}
+	return provider.Permanent
+}
+
+func (s *Shanxin) message(req *provider.Request) *SxMessage {
+	if len(req.Sequenceid) == 0 {
+		req.Sequenceid = seqid.Next()
+	}
+	m := &SxMessage{
+		Mobile:     req.Mobile,
+		Operid:     s.SxMessage.Operid,
+		Caller:     s.SxMessage.Caller,
+		Sequenceid: req.Sequenceid,
+		Tempid:     req.Tempid,
+		Enterid:    s.SxMessage.Enterid,
+		Enterpass:  s.SxMessage.Enterpass,
+		Args:       strings.Join(req.Args, argsSep),
+		MsgType:    "4",
+	}
+	if len(m.Tempid) == 0 {
+		m.Tempid = s.SxMessage.Tempid
+	}
+	return m
+}
+
+//publish encrypts the fields of m in place
+func (s *Shanxin) publish(m *SxMessage) error {
+	if len(m.Mobile) == 0 {
+		return fmt.Errorf("mobile number empty, %+v", m)
+	}
+	if err := codec.Apply(m, s.enc); err != nil {
+		return fmt.Errorf("%s, %+v", err.Error(), m)
+	}
+	return nil
+}
+
+func (s *Shanxin) post(buf []byte) (*provider.Response, error) {
+	resp, err := s.Post(s.url, "Content-Type:application/json", bytes.NewReader(buf))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error("%d, %s", resp.StatusCode, string(data))
+		return nil, &provider.StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	var rep SxResponse
+	err = json.Unmarshal(data, &rep)
+	if err != nil {
+		log.Error("%s, %s", err.Error(), string(data))
+		return nil, err
+	}
+	r := &provider.Response{Code: rep.ResultCode, Desc: rep.ResultDesc}
+	if rep.ResultCode != resultOK {
+		log.Error(string(data))
+		return r, fmt.Errorf("%+v", rep)
+	}
+	return r, nil
+}
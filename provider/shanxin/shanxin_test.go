@@ -0,0 +1,185 @@
+package shanxin
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sx/config"
+	"sx/encrypt"
+	"sx/provider"
+	"testing"
+)
+
+//TestShanxin_Send sends with the shanxin provider of conf.yml to a local
+//server standing in for the endpoint
+func TestShanxin_Send(t *testing.T) {
+	var got SxMessage
+	ts := server(t, http.StatusOK, `{"resultCode":"200","resultDesc":"ok"}`, &got)
+	defer ts.Close()
+	conf := config.NewConfig()
+	err := conf.Read("../../conf.yml")
+	assert.NoError(t, err)
+	pc := *conf.Providers["shanxin"]
+	pc.URL = ts.URL
+	p, err := New("shanxin", &pc)
+	assert.NoError(t, err)
+
+	req := &provider.Request{
+		Mobile: "13800138000",
+		Args:   []string{"icsoc"},
+	}
+	resp, err := p.Send(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "200", resp.Code)
+	assert.NotEmpty(t, got.Mobile)
+}
+
+func TestReflect(t *testing.T) {
+	m := &SxMessage{
+		Operid:    "7777",
+		Caller:    "123456",
+		Tempid:    "1222",
+		Enterid:   "dsewew23",
+		Enterpass: "sfwe3efsfds@~12",
+	}
+	value := reflect.ValueOf(m).Elem()
+	l := value.NumField()
+	assert.Equal(t, 9, l)
+	value.Field(0).SetString("aaaaaaaa")
+	assert.Equal(t, "aaaaaaaa", value.Field(0).String())
+}
+
+func server(t *testing.T, status int, body string, got *SxMessage) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(data, got))
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+//testConf is a provider of the test account, URL is set per test
+var testConf = &config.ProviderConf{
+	Type:      "shanxin",
+	URL:       "http://127.0.0.1",
+	Key:       "hg62159393",
+	Operid:    "7777",
+	Caller:    "01057624343",
+	Tempid:    "5050408",
+	Enterid:   "ZTTHSX20190402",
+	Enterpass: "ZTTH008",
+}
+
+func newShanxin(t *testing.T, url string) provider.Provider {
+	conf := *testConf
+	conf.URL = url
+	p, err := New("shanxin", &conf)
+	assert.NoError(t, err)
+	return p
+}
+
+func enc(t *testing.T, v string) string {
+	e, err := encrypt.AESBase64Encrypt(v, "hg62159393")
+	assert.NoError(t, err)
+	return e
+}
+
+func TestSend(t *testing.T) {
+	var got SxMessage
+	ts := server(t, http.StatusOK, `{"resultCode":"200","resultDesc":"ok"}`, &got)
+	defer ts.Close()
+	p := newShanxin(t, ts.URL)
+
+	req := &provider.Request{Mobile: "18627826073", Args: []string{"ClientName"}, Sequenceid: "20190409135500123_7777"}
+	resp, err := p.Send(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "200", resp.Code)
+	assert.Equal(t, "20190409135500123_7777", resp.Sequenceid)
+	assert.Equal(t, provider.Success, p.Classify(resp, err))
+
+	assert.Equal(t, enc(t, "18627826073"), got.Mobile)
+	assert.Equal(t, enc(t, "5050408"), got.Tempid)
+	assert.Equal(t, enc(t, "ClientName"), got.Args)
+	assert.Equal(t, enc(t, "4"), got.MsgType)
+	assert.Equal(t, enc(t, "ZTTH008"), got.Enterpass)
+	assert.Equal(t, enc(t, "20190409135500123_7777"), got.Sequenceid)
+
+	req = &provider.Request{Mobile: "18627826073", Tempid: "5024", Args: []string{"a", "b"}}
+	_, err = p.Send(req)
+	assert.NoError(t, err)
+	assert.Equal(t, enc(t, "5024"), got.Tempid)
+	assert.Equal(t, enc(t, "a,b"), got.Args)
+	assert.NotEmpty(t, req.Sequenceid)
+}
+
+func TestClassify(t *testing.T) {
+	var got SxMessage
+	ts := server(t, http.StatusOK, `{"resultCode":"401","resultDesc":"bad tempid"}`, &got)
+	p := newShanxin(t, ts.URL)
+	resp, err := p.Send(&provider.Request{Mobile: "18627826073"})
+	assert.Error(t, err)
+	assert.Equal(t, "401", resp.Code)
+	assert.Equal(t, provider.Permanent, p.Classify(resp, err))
+	ts.Close()
+
+	ts = server(t, http.StatusBadGateway, `bad gateway`, &SxMessage{})
+	p = newShanxin(t, ts.URL)
+	resp, err = p.Send(&provider.Request{Mobile: "18627826073"})
+	assert.Error(t, err)
+	assert.Equal(t, provider.Retryable, p.Classify(resp, err))
+	ts.Close()
+
+	//closed server, connection refused
+	resp, err = p.Send(&provider.Request{Mobile: "18627826073"})
+	assert.Error(t, err)
+	assert.Equal(t, provider.Retryable, p.Classify(resp, err))
+}
+
+func TestDryRun(t *testing.T) {
+	posts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer ts.Close()
+	p := newShanxin(t, ts.URL)
+
+	req := &provider.Request{Mobile: "18627826073", Args: []string{"ClientName"}, DryRun: true}
+	resp, err := p.Send(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, posts)
+	assert.Equal(t, "200", resp.Code)
+	assert.Equal(t, provider.DryRunDesc, resp.Desc)
+	assert.NotEmpty(t, resp.Sequenceid)
+	assert.Equal(t, provider.Success, p.Classify(resp, err))
+
+	//still checked
+	_, err = p.Send(&provider.Request{DryRun: true})
+	assert.Error(t, err)
+}
+
+func TestCipher(t *testing.T) {
+	var got SxMessage
+	ts := server(t, http.StatusOK, `{"resultCode":"200"}`, &got)
+	defer ts.Close()
+	conf := *testConf
+	conf.URL = ts.URL
+	conf.Cipher = "aes-cbc-zero"
+	conf.Encoding = encrypt.Hex
+	p, err := New("shanxin", &conf)
+	assert.NoError(t, err)
+	_, err = p.Send(&provider.Request{Mobile: "18627826073"})
+	assert.NoError(t, err)
+	//the bytes of the default base64
+	raw, _ := base64.StdEncoding.DecodeString(enc(t, "18627826073"))
+	assert.Equal(t, hex.EncodeToString(raw), got.Mobile)
+
+	conf.Cipher = "aes-cbc-fixed"
+	_, err = New("shanxin", &conf)
+	assert.Error(t, err)
+}
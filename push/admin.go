@@ -0,0 +1,17 @@
+package push
+
+import (
+	"net/http"
+)
+
+//Handle registers the admin endpoints on mux, the ledger query needs
+//LedgerDir, the blocklist api bw and BlockDir
+func (p *Push) Handle(mux *http.ServeMux, bw BlockWriter) {
+	mux.HandleFunc("/quota", p.serveQuota)
+	if p.ledger != nil {
+		mux.HandleFunc("/ledger", p.serveLedger)
+	}
+	if bw != nil && len(p.BlockDir) > 0 {
+		mux.HandleFunc("/blocklist", p.serveBlocklist(bw))
+	}
+}
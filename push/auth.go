@@ -0,0 +1,83 @@
+package push
+
+import (
+	"crypto/subtle"
+	log "github.com/alecthomas/log4go"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//Guard lets a request through if it carries Token and comes from an
+//address of Allow, an empty Token or Allow doesn't check that part. The
+//token is taken from an Authorization: Bearer header or the token query
+//parameter, for pushes that can't set headers.
+type Guard struct {
+	Token string
+	Allow []*net.IPNet
+}
+
+//ParseAllow parses addresses and CIDRs, ie: 10.0.0.0/8, 127.0.0.1
+func ParseAllow(s []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range s {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+//Wrap returns h behind the guard
+func (g Guard) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.allowed(r.RemoteAddr) {
+			log.Warn("%s %s from %s refused, address not allowed", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if !g.authorized(r) {
+			log.Warn("%s %s from %s refused, bad token", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (g Guard) allowed(remote string) bool {
+	if len(g.Allow) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	ip := net.ParseIP(host)
+	for _, n := range g.Allow {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g Guard) authorized(r *http.Request) bool {
+	if len(g.Token) == 0 {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(g.Token)) == 1
+}
@@ -0,0 +1,37 @@
+package push
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	allow, err := ParseAllow([]string{"10.0.0.0/8", "127.0.0.1"})
+	assert.NoError(t, err)
+	h := Guard{Token: "s3cret", Allow: allow}.Wrap(ok)
+	serve := func(remote, url, auth string) int {
+		r := httptest.NewRequest("GET", url, nil)
+		r.RemoteAddr = remote
+		if len(auth) > 0 {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, serve("127.0.0.1:5000", "/quota", "Bearer s3cret"))
+	assert.Equal(t, http.StatusOK, serve("10.1.2.3:5000", "/dlr/shanxin?token=s3cret", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("127.0.0.1:5000", "/quota", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("127.0.0.1:5000", "/quota", "Bearer x"))
+	assert.Equal(t, http.StatusForbidden, serve("192.168.1.1:5000", "/quota", "Bearer s3cret"))
+
+	//nothing to check
+	h = Guard{}.Wrap(ok)
+	assert.Equal(t, http.StatusOK, serve("192.168.1.1:5000", "/quota", ""))
+
+	_, err = ParseAllow([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package push
+
+import (
+	"encoding/json"
+	log "github.com/alecthomas/log4go"
+	"net/http"
+	"sx/config"
+	"sx/phone"
+	"time"
+)
+
+//BlockWriter stores blocklist entries, implemented by config.Watcher
+//which writes them to etcd
+type BlockWriter interface {
+	PutBlock(dir, scope, mobile string, e *config.BlockEntry) error
+	DeleteBlock(dir, scope, mobile string) error
+}
+
+//blockRequest adds a mobile to the blocklist of Scope
+type blockRequest struct {
+	Scope  string `json:"scope"`
+	Mobile string `json:"mobile"`
+	By     string `json:"by"`
+	Note   string `json:"note"`
+}
+
+//serveBlocklist lists the blocklist of a scope on GET, adds the entry of
+//a json blockRequest on POST and removes scope/mobile on DELETE. The
+//mobile is normalized the way call events are.
+func (p *Push) serveBlocklist(bw BlockWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			req blockRequest
+			err error
+		)
+		if r.Method == http.MethodPost {
+			if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			req = blockRequest{Scope: r.FormValue("scope"), Mobile: r.FormValue("mobile"), By: r.FormValue("by")}
+		}
+		if len(req.Scope) == 0 {
+			req.Scope = config.ScopeGlobal
+		}
+		if err = config.ValidScope(req.Scope); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p.Blocks(req.Scope))
+			return
+		}
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(req.By) == 0 {
+			http.Error(w, "by required", http.StatusBadRequest)
+			return
+		}
+		mobile, err := phone.Normalize(req.Mobile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			err = bw.PutBlock(p.BlockDir, req.Scope, mobile, &config.BlockEntry{By: req.By, At: time.Now().Unix(), Note: req.Note})
+		} else {
+			err = bw.DeleteBlock(p.BlockDir, req.Scope, mobile)
+		}
+		if err != nil {
+			log.Error("blocklist %s %s/%s, %s", r.Method, req.Scope, mobile, err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Info("blocklist %s %s/%s by %s, %s", r.Method, req.Scope, mobile, req.By, req.Note)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
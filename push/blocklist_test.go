@@ -0,0 +1,73 @@
+package push
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sx/config"
+	"testing"
+)
+
+//blockWriter applies entries to the config as the etcd watch would
+type blockWriter struct {
+	conf *config.Config
+}
+
+func (b *blockWriter) PutBlock(dir, scope, mobile string, e *config.BlockEntry) error {
+	b.conf.SetBlock(scope, mobile, e)
+	return nil
+}
+
+func (b *blockWriter) DeleteBlock(dir, scope, mobile string) error {
+	b.conf.DelBlock(scope, mobile)
+	return nil
+}
+
+func TestBlocklist(t *testing.T) {
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	assert.Equal(t, "/shanxinConfig/blocklist", conf.BlockDir)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	mux := http.NewServeMux()
+	p.Handle(mux, &blockWriter{conf})
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+	before := count(skipped, string(ReasonBlocked))
+
+	rec := do("POST", "/blocklist", `{"scope":"782","mobile":"+86 138-0013-8000","by":"ops","note":"complaint"}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.NoError(t, p.ReadMsg(delivery("13900139000")))
+	assert.Equal(t, 1, sends)
+	assert.Equal(t, before+1, count(skipped, string(ReasonBlocked)))
+
+	rec = do("GET", "/blocklist?scope=782", "")
+	assert.Contains(t, rec.Body.String(), `"13800138000":{"by":"ops"`)
+
+	assert.Equal(t, http.StatusNoContent, do("POST", "/blocklist", `{"mobile":"13900139000","by":"ops"}`).Code)
+	assert.NoError(t, p.ReadMsg(delivery("13900139000")))
+	assert.Equal(t, 1, sends)
+
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/blocklist?scope=782&mobile=13800138000&by=ops", "").Code)
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 2, sends)
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/blocklist", `{"mobile":"13900139000"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/blocklist", `{"mobile":"010-12345678","by":"ops"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/blocklist?scope=x", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do("PUT", "/blocklist", "").Code)
+}
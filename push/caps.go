@@ -0,0 +1,50 @@
+package push
+
+import (
+	log "github.com/alecthomas/log4go"
+	"strconv"
+	"sx/config"
+	"sx/limit"
+	"sync"
+)
+
+//vccCaps caches the parsed caps overrides of vccs by text, a bad override
+//is kept with its error so it is logged once
+type vccCaps struct {
+	lock  sync.Mutex
+	byDef map[string]parsedCaps
+}
+
+type parsedCaps struct {
+	caps []limit.Cap
+	err  error
+}
+
+//capsOf returns the caps of a vcc, its FlashSMS record overrides the
+//configured ones. A bad override falls back to the configured caps.
+func (p *Push) capsOf(f *config.FlashSMS) []limit.Cap {
+	if len(f.Caps) == 0 {
+		return p.caps
+	}
+	p.vccCaps.lock.Lock()
+	defer p.vccCaps.lock.Unlock()
+	c, ok := p.vccCaps.byDef[f.Caps]
+	if !ok {
+		c.caps, c.err = limit.ParseCaps(f.Caps)
+		if c.err != nil {
+			log.Error("vcc_id %d caps %q, %s, configured caps used", f.VccID, f.Caps, c.err.Error())
+		}
+		if p.vccCaps.byDef == nil {
+			p.vccCaps.byDef = make(map[string]parsedCaps)
+		}
+		p.vccCaps.byDef[f.Caps] = c
+	}
+	if c.err != nil {
+		return p.caps
+	}
+	return c.caps
+}
+
+func capKey(ev *event, target string) string {
+	return strconv.Itoa(ev.conf.VccID) + ":" + target
+}
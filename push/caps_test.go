@@ -0,0 +1,57 @@
+package push
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sx/config"
+	"testing"
+)
+
+func TestCaps(t *testing.T) {
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	assert.Equal(t, "1/30m,3/24h", conf.Caps)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	before := count(skipped, string(ReasonCapped))
+
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.NoError(t, p.ReadMsg(delivery("13900139000")))
+	assert.Equal(t, 2, sends)
+	assert.Equal(t, before+1, count(skipped, string(ReasonCapped)))
+
+	//per vcc override
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Caps: "2/1h"})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 3, sends)
+
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Caps: "off"})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 4, sends)
+
+	//a bad override keeps the configured caps
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Caps: "x"})
+	assert.NoError(t, p.ReadMsg(delivery("13900139000")))
+	assert.Equal(t, 4, sends)
+	//remembered with its error, and kept by p only
+	assert.Error(t, p.vccCaps.byDef["x"].err)
+	assert.Equal(t, p.caps, p.capsOf(&config.FlashSMS{VccID: 782, Caps: "x"}))
+	q, err := NewPusher(conf)
+	assert.NoError(t, err)
+	assert.Empty(t, q.vccCaps.byDef)
+
+	conf.Caps = "1/x"
+	_, err = NewPusher(conf)
+	assert.Error(t, err)
+}
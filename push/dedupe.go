@@ -0,0 +1,47 @@
+package push
+
+import (
+	log "github.com/alecthomas/log4go"
+	"sx/rule"
+)
+
+//dedupeKeys returns the keys of an event, a redelivered message has the
+//same MSGID, msgproxy emitting a call event twice the same call_id
+func dedupeKeys(ev *event, target string) []string {
+	keys := make([]string, 0, 2)
+	if len(ev.MSGID) > 0 {
+		keys = append(keys, "msgid:"+ev.MSGID)
+	}
+	if id, ok := rule.Field(ev.MSG, "call_id"); ok && len(id) > 0 {
+		keys = append(keys, "call:"+id+":"+target)
+	}
+	return keys
+}
+
+//duplicate tells whether the event was sent already, when the store
+//fails the event is taken as new
+func (p *Push) duplicate(ev *event, target string) bool {
+	keys := dedupeKeys(ev, target)
+	if p.handled == nil || len(keys) == 0 {
+		return false
+	}
+	seen, err := p.handled.Seen(keys...)
+	if err != nil {
+		log.Error("dedupe %v, %s", keys, err.Error())
+		return false
+	}
+	return seen
+}
+
+//markSent remembers a sent event for dedupe and frequency caps, failed
+//sends are not marked so that retries go through
+func (p *Push) markSent(ev *event, target string) {
+	p.limiter.Record(capKey(ev, target), p.capsOf(ev.conf))
+	keys := dedupeKeys(ev, target)
+	if p.handled == nil || len(keys) == 0 {
+		return
+	}
+	if err := p.handled.Mark(keys...); err != nil {
+		log.Error("dedupe mark %v, %s", keys, err.Error())
+	}
+}
@@ -0,0 +1,52 @@
+package push
+
+import (
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sx/config"
+	"testing"
+)
+
+func TestDuplicate(t *testing.T) {
+	code := http.StatusOK
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.WriteHeader(code)
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	p.sender = &sender{}
+	before := count(skipped, string(ReasonDuplicate))
+
+	d := delivery("13800138000")
+	assert.NoError(t, p.ReadMsg(d))
+	//redelivered
+	assert.NoError(t, p.ReadMsg(d))
+	assert.Equal(t, 1, sends)
+
+	//emitted twice by msgproxy with another MSGID
+	body := []byte(`{"MSGID":"x","MSG":{"vcc_id":"782","call_id":"dup","called":"13800138000","status":"1","user_data":{"ClientName":"icsoc"}}}`)
+	assert.NoError(t, p.ReadMsg(&amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: body}))
+	body2 := []byte(`{"MSGID":"y","MSG":{"vcc_id":"782","call_id":"dup","called":"13800138000","status":"1","user_data":{"ClientName":"icsoc"}}}`)
+	assert.NoError(t, p.ReadMsg(&amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: body2}))
+	assert.Equal(t, 2, sends)
+	assert.Equal(t, before+2, count(skipped, string(ReasonDuplicate)))
+
+	//failed sends are not remembered, the retry goes through
+	code = http.StatusBadGateway
+	d = delivery("13800138000")
+	assert.NoError(t, p.ReadMsg(d))
+	code = http.StatusOK
+	assert.NoError(t, p.ReadMsg(d))
+	assert.Equal(t, 4, sends)
+}
@@ -0,0 +1,96 @@
+package push
+
+import (
+	"bytes"
+	"expvar"
+	log "github.com/alecthomas/log4go"
+	"sync"
+	"sx/carrier"
+	"sx/provider"
+	"text/template"
+	"time"
+)
+
+const (
+	channelFlash    = "flash"
+	channelFallback = "fallback"
+)
+
+//sent counts accepted messages by channel, flash and fallback are
+//billed apart
+var sent = expvar.NewMap("sent")
+
+//fallbackData is the data of a FallbackText template
+type fallbackData struct {
+	Mobile string
+	Vccid  int
+	MSG    map[string]interface{}
+}
+
+var (
+	tmplLock  sync.Mutex
+	templates = make(map[string]*template.Template)
+)
+
+//fallbackTemplate returns the parsed template of text, parsed templates
+//are cached
+func fallbackTemplate(text string) (*template.Template, error) {
+	tmplLock.Lock()
+	defer tmplLock.Unlock()
+	if t, ok := templates[text]; ok {
+		return t, nil
+	}
+	t, err := template.New("fallback").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templates[text] = t
+	return t, nil
+}
+
+func render(ev *event, target string) (string, error) {
+	t, err := fallbackTemplate(ev.conf.FallbackText)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, &fallbackData{Mobile: target, Vccid: ev.conf.VccID, MSG: ev.MSG}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//fallback sends an ordinary sms when the vcc configures one, cause is
+//why flash was not delivered. It reports whether a fallback was tried.
+func (p *Push) fallback(ev *event, seg carrier.Segment, target, cause string) bool {
+	if len(ev.conf.Fallback) == 0 || len(ev.conf.FallbackText) == 0 {
+		return false
+	}
+	fb, ok := p.providers.Get(ev.conf.Fallback)
+	if !ok {
+		log.Error("vcc_id %d fallback provider %s not configured", ev.conf.VccID, ev.conf.Fallback)
+		return false
+	}
+	caps := fb.Capabilities()
+	if !caps.Text || !seg.Host.In(caps.Carriers) {
+		log.Error("vcc_id %d fallback provider %s can't send text to %s", ev.conf.VccID, fb.Name(), seg.Carrier)
+		return false
+	}
+	text, err := render(ev, target)
+	if err != nil {
+		log.Error("vcc_id %d fallback text, %s", ev.conf.VccID, err.Error())
+		return false
+	}
+	req := &provider.Request{Mobile: target, Text: text, DryRun: p.dryRun(ev)}
+	start := time.Now()
+	resp, err := fb.Send(req)
+	p.record(fb, ev, req, resp, err, time.Since(start))
+	if err != nil {
+		log.Error("fallback %s, provider %s, %s, %s", target, fb.Name(), fb.Classify(resp, err), err.Error())
+		return true
+	}
+	sent.Add(channelFallback, 1)
+	p.markSent(ev, target)
+	log.Info("channel:%s vcc_id:%d %s provider %s, cause: %s", channelFallback, ev.conf.VccID, target, fb.Name(), cause)
+	return true
+}
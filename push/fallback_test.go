@@ -0,0 +1,101 @@
+package push
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sx/broker"
+	"sx/config"
+	"sx/provider/httpsms"
+	"testing"
+	"time"
+)
+
+func count(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+var calls int
+
+//delivery returns a missed call event of a new call
+func delivery(called string) *amqp.Delivery {
+	calls++
+	id := strconv.Itoa(calls)
+	d := `{"MSGID":"` + id + `","MSG":{"vcc_id":"782","call_id":"` + id + `","called":"` + called + `","status":"1","user_data":{"ClientName":"icsoc"}}}`
+	return &amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte(d)}
+}
+
+func TestFallback(t *testing.T) {
+	flashCode := "200"
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flashCode == "502" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"resultCode":"` + flashCode + `"}`))
+	}))
+	defer flash.Close()
+	var texts []httpsms.Message
+	text := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m httpsms.Message
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&m))
+		texts = append(texts, m)
+		w.Write([]byte(`{"code":"0"}`))
+	}))
+	defer text.Close()
+
+	conf := testConf(t)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.Providers["text"] = &config.ProviderConf{Type: "httpsms", URL: text.URL}
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Param: "ClientName",
+		Fallback: "text", FallbackText: "{{.MSG.user_data.ClientName}}来电 {{.Mobile}}"})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	p.sender = &sender{}
+
+	flashes, fallbacks := count(sent, channelFlash), count(sent, channelFallback)
+
+	//telecom, flash can't reach it
+	assert.NoError(t, p.ReadMsg(delivery("13300000000")))
+	assert.Equal(t, 1, len(texts))
+	assert.Equal(t, "icsoc来电 13300000000", texts[0].Content)
+	assert.Equal(t, "13300000000", texts[0].Mobile)
+
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, len(texts))
+
+	//rejected by the flash provider
+	flashCode = "401"
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 2, len(texts))
+
+	//retryable, no fallback until the retries are used up
+	flashCode = "502"
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 2, len(texts))
+	s := &sender{}
+	p.sender = s
+	p.retries = &broker.Retry{Queue: "q", Exchange: "q.retry", Parking: "q.parking", Max: 0, Delay: time.Second}
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, []string{"q.parking"}, s.keys)
+	assert.Equal(t, 3, len(texts))
+	p.retries = nil
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 4, len(texts))
+
+	assert.Equal(t, flashes+1, count(sent, channelFlash))
+	assert.Equal(t, fallbacks+4, count(sent, channelFallback))
+
+	//broken template, nothing sent
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Fallback: "text", FallbackText: "{{.MSG.nope}}"})
+	assert.NoError(t, p.ReadMsg(delivery("13300000000")))
+	assert.Equal(t, 4, len(texts))
+}
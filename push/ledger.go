@@ -0,0 +1,107 @@
+package push
+
+import (
+	"encoding/json"
+	log "github.com/alecthomas/log4go"
+	"net/http"
+	"strconv"
+	"sx/dlr"
+	"sx/ledger"
+	"sx/phone"
+	"sx/provider"
+	"sx/rule"
+	"time"
+)
+
+const (
+	//ledgerLimit and ledgerMaxLimit bound the entries a query returns
+	ledgerLimit    = 100
+	ledgerMaxLimit = 1000
+	//ledgerSince is the range of a query without from
+	ledgerSince = 24 * time.Hour
+)
+
+//record writes a send attempt to the ledger
+func (p *Push) record(prov provider.Provider, ev *event, req *provider.Request, resp *provider.Response, err error, latency time.Duration) {
+	if p.ledger == nil {
+		return
+	}
+	callID, _ := rule.Field(ev.MSG, "call_id")
+	e := &ledger.Entry{
+		VccID:      ev.conf.VccID,
+		CallID:     callID,
+		Mobile:     req.Mobile,
+		Provider:   prov.Name(),
+		Template:   req.Tempid,
+		Sequenceid: req.Sequenceid,
+		LatencyMs:  int64(latency / time.Millisecond),
+		State:      ledger.Accepted,
+	}
+	if len(req.Text) > 0 {
+		e.Template = channelFallback
+	}
+	if resp != nil {
+		e.Code, e.Desc = resp.Code, resp.Desc
+	}
+	switch {
+	case err != nil:
+		e.State, e.Error = ledger.Error, err.Error()
+	case req.DryRun:
+		e.State = ledger.DryRun
+	case p.tracks(prov, ev):
+		e.State = string(dlr.Pending)
+	}
+	if err := p.ledger.Add(e); err != nil {
+		log.Error("ledger, %s", err.Error())
+	}
+}
+
+//serveLedger answers the entries matching vcc_id, call_id, mobile, from
+//and to (RFC3339, the last day by default) and limit
+func (p *Push) serveLedger(w http.ResponseWriter, r *http.Request) {
+	q := ledger.Query{CallID: r.FormValue("call_id"), Limit: ledgerLimit, From: time.Now().Add(-ledgerSince)}
+	var err error
+	if s := r.FormValue("vcc_id"); len(s) > 0 {
+		if q.VccID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "bad vcc_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if s := r.FormValue("mobile"); len(s) > 0 {
+		if q.Mobile, err = phone.Normalize(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if s := r.FormValue(name); len(s) > 0 {
+			if *t, err = time.Parse(time.RFC3339, s); err != nil {
+				http.Error(w, "bad "+name+", want RFC3339", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if s := r.FormValue("limit"); len(s) > 0 {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 || q.Limit > ledgerMaxLimit {
+			http.Error(w, "bad limit, want 1-"+strconv.Itoa(ledgerMaxLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := p.ledger.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []ledger.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+//RunLedger prunes the ledger until done is closed
+func (p *Push) RunLedger(done <-chan struct{}) {
+	if p.ledger != nil {
+		p.ledger.Run(done)
+	}
+}
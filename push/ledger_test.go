@@ -0,0 +1,99 @@
+package push
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sx/config"
+	"sx/encrypt"
+	"sx/ledger"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := testConf(t)
+	key := conf.Providers["shanxin"].Key
+	code := http.StatusOK
+	var ids []string
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&m))
+		id, _ := encrypt.AESBase64Decrypt(m["sequenceid"], key)
+		ids = append(ids, id)
+		w.WriteHeader(code)
+		w.Write([]byte(`{"resultCode":"200","resultDesc":"ok"}`))
+	}))
+	defer flash.Close()
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.RetryMax = 0
+	conf.LedgerDir = dir
+	conf.LedgerSecret = "salt"
+	conf.LedgerRetention = time.Hour
+	conf.DLRAddr = ":0"
+	conf.DLRTimeout = time.Hour
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	defer p.Close()
+	p.sender = &sender{}
+
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	code = http.StatusBadRequest
+	assert.NoError(t, p.ReadMsg(delivery("13800138001")))
+
+	mux := http.NewServeMux()
+	p.Handle(mux, nil)
+	p.HandleReports(mux)
+	body, _ := json.Marshal(map[string]string{"sequenceid": enc(t, ids[0], key), "status": enc(t, "DELIVRD", key)})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/dlr/shanxin", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	query := func(q string) []ledger.Entry {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/ledger?"+q, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, q)
+		var entries []ledger.Entry
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		return entries
+	}
+	entries := query("vcc_id=782")
+	assert.Equal(t, 2, len(entries))
+	e := query("mobile=%2B86%20138-0013-8000")
+	assert.Equal(t, 1, len(e))
+	assert.Equal(t, "138****8000", e[0].Mobile)
+	assert.Equal(t, ids[0], e[0].Sequenceid)
+	assert.Equal(t, "shanxin", e[0].Provider)
+	assert.Equal(t, "200", e[0].Code)
+	assert.Equal(t, "delivered", e[0].State)
+	assert.NotEmpty(t, e[0].CallID)
+	e = query("call_id=" + e[0].CallID)
+	assert.Equal(t, 1, len(e))
+	e = query("mobile=13800138001")
+	assert.Equal(t, ledger.Error, e[0].State)
+	assert.Contains(t, e[0].Error, "400")
+	assert.Equal(t, 0, len(query("vcc_id=783")))
+	assert.Equal(t, 0, len(query("to="+time.Now().Add(-time.Hour).Format(time.RFC3339))))
+
+	for _, q := range []string{"vcc_id=x", "mobile=123", "from=yesterday", "limit=0"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/ledger?"+q, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, q)
+	}
+}
+
+func enc(t *testing.T, v, key string) string {
+	e, err := encrypt.AESBase64Encrypt(v, key)
+	assert.NoError(t, err)
+	return e
+}
@@ -1,13 +0,0 @@
-package push
-
-import "testing"
-
-//{Mobile:4IivQaPDhFuw6uVsR8FGpA== Operid:EM+/PKF5bfExfRfrM4yg1A== Caller:IcJI36+GeV7XgUHB6ZRoug== Sequenceid:4pCrAQH+RZ/Xl2Wn8bkJFnsoDfW4lxj3bW2y3sQVdLA= Tempid:f9i8Ai7hXJKoXj2wEtO/QQ== Enterid:Fh0B
-//W4NMhDRhlGfzKnm83w== Enterpass:UubM9ajIurxg8MJtdLi4oQ== Args:y2g4uObdVTWleEmHT5eBDg== MsgType:Ifd8TlqL1SHYrF9YsSkzyQ==}
-//
-//{Mobile:Q8WxAJTl1dQGEyjY0nOX6w== Operid:EM+/PKF5bfExfRfrM4yg1A== Caller:IcJI36+GeV7XgUHB6ZRoug== Sequenceid:yTjbCOdbTcJ5ZWYEPHnfFozWEuEqk2C0KsNkIa6alK8= Tempid:f9i8Ai7hXJKoXj2wEtO/QQ== Enterid:Fh0B
-//W4NMhDRhlGfzKnm83w== Enterpass:UubM9ajIurxg8MJtdLi4oQ== Args:y2g4uObdVTWleEmHT5eBDg== MsgType:Ifd8TlqL1SHYrF9YsSkzyQ==}
-
-func BenchmarkPublish(b *testing.B){
-
-}
\ No newline at end of file
@@ -1,20 +1,29 @@
 package push
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	log "github.com/alecthomas/log4go"
 	"github.com/streadway/amqp"
-	"io/ioutil"
-	"net/http"
-	"reflect"
-	"regexp"
+	"io"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sx/broker"
+	"sx/carrier"
 	"sx/config"
-	"sx/encrypt"
+	"sx/dedupe"
+	"sx/deferred"
+	"sx/dlr"
+	"sx/ledger"
+	"sx/limit"
+	"sx/param"
+	"sx/phone"
+	"sx/provider"
+	"sx/quota"
+	"sx/redact"
+	"sx/rule"
 	"time"
 )
 
@@ -23,25 +32,9 @@ var (
 	errNotSupportRoutingKey = errors.New("not support this routingkey")
 	errNoneVCCID            = errors.New("none exist vcc_id")
 	errWrongVCCID           = errors.New("vcc_id wrong")
+	errVccidDisabled        = errors.New("vcc_id disabled")
 )
 
-type SxMessage struct {
-	Mobile     string `json:"mobile"`
-	Operid     string `json:"operid"`
-	Caller     string `json:"caller"`
-	Sequenceid string `json:"sequenceid"`
-	Tempid     string `json:"tempid"`
-	Enterid    string `json:"enterid"`
-	Enterpass  string `json:"enterpass"`
-	Args       string `json:"args"`
-	MsgType    string `json:"msgType"`
-}
-
-type SxResponse struct {
-	ResultCode string `json:"resultCode"`
-	ResultDesc string `json:"resultDesc"`
-}
-
 type Message struct {
 	MainType int                    `json:"MainType"`
 	ExtType  int                    `json:"ExtType"`
@@ -52,11 +45,30 @@ type Message struct {
 	MSG      map[string]interface{} `json:"MSG"`
 }
 
+//event is a call event matched by a rule
+type event struct {
+	Message
+	rule   *rule.Rule
+	conf   *config.FlashSMS
+	target string
+}
+
 type Push struct {
-	url string
-	key string
-	SxMessage
-	*http.Client
+	providers *provider.Registry
+	args      map[string][]param.Param //default template arguments by provider
+	retries   *broker.Retry            //nil if retry is disabled
+	dead      *broker.DeadLetter       //nil if dead lettering is disabled
+	deadFor   map[Reason]bool
+	sender    broker.Sender
+	handled   dedupe.Store //nil if dedupe is disabled
+	caps      []limit.Cap  //default caps of a vcc
+	vccCaps   vccCaps      //caps overrides of vccs
+	limiter   *limit.Limiter
+	quotas    *quota.Counter
+	deferred  *deferred.Store
+	schedules schedules      //send windows of vccs
+	reports   *dlr.Tracker   //nil if reports are not taken
+	ledger    *ledger.Ledger //nil if sends are not recorded
 	*config.Config
 }
 
@@ -64,314 +76,291 @@ func NewPusher(conf *config.Config) (*Push, error) {
 	if conf == nil {
 		panic("conf nil")
 	}
+	providers, err := provider.NewRegistry(conf)
+	if err != nil {
+		return nil, err
+	}
 	p := &Push{
-		url: conf.URL,
-		key: conf.Key,
-		SxMessage: SxMessage{
-			Operid:    conf.Operid,
-			Caller:    conf.Caller,
-			Tempid:    conf.Tempid,
-			Enterid:   conf.Enterid,
-			Enterpass: conf.Enterpass,
-			Args:      conf.Args,
-		},
-		Client: &http.Client{Timeout: time.Second * 3},
-		Config: conf,
+		providers: providers,
+		args:      make(map[string][]param.Param, len(conf.Providers)),
+		limiter:   limit.NewLimiter(),
+		Config:    conf,
 	}
-	return p, nil
-}
-
-//ReadMsg handler for rmq
-func (p *Push) ReadMsg(msg *amqp.Delivery) error {
-	log.Debug("rx routingKey: %s, %s", msg.RoutingKey, string(msg.Body))
-	phone, err := p.parseMessage(msg)
-	if err == nil {
-		valid, target := p.valid(phone)
-		if !valid {
-			log.Warn("invalid phone: %s", phone)
-			return nil
+	if p.caps, err = limit.ParseCaps(conf.Caps); err != nil {
+		return nil, err
+	}
+	if p.quotas, err = quota.Open(conf.QuotaFile); err != nil {
+		return nil, err
+	}
+	if p.deferred, err = deferred.Open(conf.DeferDir); err != nil {
+		return nil, err
+	}
+	if len(conf.LedgerDir) > 0 {
+		if p.ledger, err = ledger.Open(conf.LedgerDir, conf.LedgerRetention, conf.LedgerSecret); err != nil {
+			return nil, err
 		}
-		//skip phones of Telecom
-		if !p.support(target) {
-			log.Warn("China Telecom not supported")
-			return nil
+	}
+	if len(conf.DLRAddr) > 0 {
+		p.reports = dlr.NewTracker(conf.DLRTimeout, p.finished)
+		if p.ledger != nil {
+			if err = p.reload(); err != nil {
+				return nil, err
+			}
 		}
-		err = p.publish(&SxMessage{Mobile: target})
-		if err == nil {
-			log.Debug("send %s ok", target)
+	}
+	for name, pc := range conf.Providers {
+		if p.args[name], err = param.Parse(pc.Args); err != nil {
+			return nil, fmt.Errorf("provider %s args: %s", name, err.Error())
 		}
-		return nil
 	}
-	log.Warn(err)
-	return nil
-}
-
-//China Telecom
-//133,1349,153,189,180,181,177,173,149,1700,1701,1702,199,1410
-//China Unicom
-//130,131,132,156,155,186,185,145,176,175,1707,1708,1709,166,146
-//China Mobile Communication
-//139,138,137,136,135,1340,1341,1342,1343,1344,1345,1346,1347,1348,159,158,157,150,151,152,147,188,187,182,183,184,178,1703,1705,1706,198,148,1440
-//todo...enchance efficiency of algorithm
-func (p *Push) support(phone string) bool {
-	l := "133,1349,153,189,180,181,177,173,149,1700,1701,1702,199,1410"
-	s := strings.Split(l, ",")
-	if len(phone) == 12 {
-		phone = phone[1:]
-	}
-	for _, v := range s {
-		if strings.HasPrefix(phone, v) {
-			return false
+	if conf.RetryMax > 0 {
+		p.retries = &broker.Retry{
+			Queue:    conf.QueueName,
+			Exchange: conf.RetryExchange,
+			Parking:  conf.ParkingQueue,
+			Max:      conf.RetryMax,
+			Delay:    conf.RetryDelay,
+			MaxDelay: conf.RetryMaxDelay,
 		}
 	}
-	return true
-}
-
-func (p *Push) checkVccid(m *Message) (bool, error) {
-	vccid, ok := m.MSG["vcc_id"]
-	if !ok {
-		return false, errNoneVCCID
+	if len(conf.DeadQueue) > 0 {
+		p.dead = &broker.DeadLetter{Exchange: conf.DeadExchange, Queue: conf.DeadQueue}
+		p.deadFor = make(map[Reason]bool, len(conf.DeadReasons))
+		for _, r := range conf.DeadReasons {
+			p.deadFor[Reason(r)] = true
+		}
 	}
-	strVccid := vccid.(string)
-	if len(strVccid) == 0 {
-		return false, errWrongVCCID
+	if conf.DedupeTTL > 0 {
+		if len(conf.DedupePrefix) > 0 {
+			if p.handled, err = dedupe.NewEtcd(conf.EtcdURL, conf.DedupePrefix, conf.DedupeSize, conf.DedupeTTL); err != nil {
+				return nil, err
+			}
+		} else {
+			p.handled = dedupe.NewLRU(conf.DedupeSize, conf.DedupeTTL)
+		}
 	}
-	id, _ := strconv.Atoi(strVccid)
-	_, err := p.GetSmsConf(id)
-	if err != nil {
-		return false, err
+	if p.retries != nil || p.dead != nil || len(conf.QuotaWarnKey) > 0 {
+		p.sender = broker.NewPublisher(conf.RabbitmqAddrs, p.declare)
 	}
-	return true, nil
+	return p, nil
 }
 
-func (p *Push) parseMessage(msg *amqp.Delivery) (string, error) {
-	defer func() {
-		if err := recover(); err != nil {
-			log.Error(err)
-		}
-	}()
-
-	var (
-		m      Message
-		target string
-	)
-	if msg.RoutingKey == "msgproxy.1.21" {
-		err := json.Unmarshal(msg.Body, &m)
-		if err != nil {
-			return "", err
-		}
-		if exist, err := p.checkVccid(&m); !exist {
-			return "", err
-		}
-
-		status, ok := m.MSG["status"]
-		if ok {
-			s := status.(string)
-			if s == "1" {
-				t, ok := m.MSG["called"]
-				if ok {
-					target = t.(string)
-				}
-			} else if s == "5" {
-				t, ok := m.MSG["trans_called"]
-				if ok {
-					target = t.(string)
-				}
-			}
+//declare declares the queues and exchanges republishing uses
+func (p *Push) declare(ch *amqp.Channel) error {
+	if p.retries != nil {
+		if err := p.retries.Declare(ch); err != nil {
+			return err
 		}
-	} else if msg.RoutingKey == "msgproxy.2.10" {
-		err := json.Unmarshal(msg.Body, &m)
-		if err != nil {
-			return "", err
-		}
-		if exist, err := p.checkVccid(&m); !exist {
-			return "", err
-		}
-		status, ok := m.MSG["call_sta"]
-		if ok {
-			s := status.(string)
-			if s == "2" {
-				t, ok := m.MSG["user_num"]
-				if ok {
-					target = t.(string)
-				}
-			}
-		}
-	} else {
-		return "", errNotSupportRoutingKey
 	}
-	if len(target) == 0 {
-		return "", errPhoneNoneExist
+	if p.dead != nil {
+		return p.dead.Declare(ch)
 	}
-	return target, nil
+	return nil
 }
 
-//1开头11位
-//01开头12位并且不是010开头
-func (p *Push) valid(phone string) (bool, string) {
-	target := phone
-	pattern := "^[0-9]*$" //反斜杠要转义
-	if result, err := regexp.MatchString(pattern, phone); err == nil {
-		if !result {
-			return false, ""
+//Close closes the connection used to republish, the dedupe store and
+//the ledger, and flushes the quota counters
+func (p *Push) Close() error {
+	if c, ok := p.handled.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Error("dedupe, %s", err.Error())
 		}
 	}
-
-	l := len(phone)
-	if l == 12 {
-		if phone[0] == '0' {
-			target = phone[1:]
-		} else {
-			return false, ""
+	if err := p.quotas.Close(); err != nil {
+		log.Error("quota, %s", err.Error())
+	}
+	if p.ledger != nil {
+		if err := p.ledger.Close(); err != nil {
+			log.Error("ledger, %s", err.Error())
 		}
 	}
-
-	begin := string(target[0])
-	begin2 := string(target[1])
-	if begin == "1" && begin2 != "0" {
-		return true, target
+	if c, ok := p.sender.(*broker.Publisher); ok {
+		return c.Close()
 	}
-
-	return false, ""
+	return nil
 }
 
-//Deprecated
-func (p *Push) parseMessage2(msg *amqp.Delivery)(string, error){
+//ReadMsg handler for rmq, it returns an error only if a retryable
+//failure could not be scheduled for retry
+func (p *Push) ReadMsg(msg *amqp.Delivery) (err error) {
+	//a panic would kill the consumer and come back with each redelivery,
+	//the message is dead lettered or acked instead
 	defer func() {
-		if err := recover(); err != nil{
-			log.Error(err)
+		if r := recover(); r != nil {
+			log.Error("panic: %v, %s\n%s", r, redact.Body(msg.Body), debug.Stack())
+			p.skip(ReasonPanic, nil, fmt.Sprint(r))
+			err = p.deadLetter(msg, ReasonPanic, fmt.Errorf("panic: %v", r))
 		}
 	}()
-
-	var (
-		m	Message
-		target string
-	)
-	switch msg.RoutingKey {
-	case "msgproxy.1.21":
-		err := json.Unmarshal(msg.Body, &m)
-		if err != nil{
-			return "", err
-		}
-		value := reflect.ValueOf(m.MSG)
-		if status := value.FieldByName("status");status != (reflect.Value{}){
-			s := status.String()
-			if s == "1"{
-				target = value.FieldByName("called").String()
-			}else if s == "5"{
-				target = value.FieldByName("trans_called").String()
-			}
-		}
-	case "msgproxy.2.10":
-		err := json.Unmarshal(msg.Body, &m)
-		if err != nil{
-			return "", err
-		}
-		value := reflect.ValueOf(m.MSG).Elem()
-		if status := value.FieldByName("call_sta");status != (reflect.Value{}){
-			s := status.String()
-			if s == "2"{
-				target = value.FieldByName("user_num").String()
-			}
+	log.Debug("rx routingKey: %s, attempt: %d, %s", broker.RoutingKey(msg), broker.Attempt(msg), redact.Body(msg.Body))
+	ev, reason, err := p.parseMessage(msg)
+	if err != nil {
+		p.skip(reason, ev, err.Error())
+		return p.deadLetter(msg, reason, err)
+	}
+	if !ev.rule.Allowed(ev.conf.Msgflag) {
+		p.skip(ReasonMsgflag, ev, fmt.Sprintf("msgflag %d, kind %s", ev.conf.Msgflag, ev.rule.Kind))
+		return nil
+	}
+	target, err := phone.Normalize(ev.target)
+	if err != nil {
+		p.skip(ReasonInvalidPhone, ev, err.Error())
+		return nil
+	}
+	if scope, e := p.Blocked(ev.conf.VccID, target); e != nil {
+		p.skip(ReasonBlocked, ev, fmt.Sprintf("%s in %s blocklist, by %s, %s", target, scope, e.By, e.Note))
+		return nil
+	}
+	if p.duplicate(ev, target) {
+		p.skip(ReasonDuplicate, ev, fmt.Sprintf("msgid %s, %s", ev.MSGID, target))
+		return nil
+	}
+	if c := p.limiter.Allow(capKey(ev, target), p.capsOf(ev.conf)); c != nil {
+		p.skip(ReasonCapped, ev, fmt.Sprintf("%s, cap %s", target, c))
+		return nil
+	}
+	if period := limitOf(ev.conf).Exceeded(p.quotas.Used(ev.conf.VccID)); len(period) > 0 {
+		p.skip(ReasonQuota, ev, fmt.Sprintf("%s, %s quota used up", target, period))
+		return nil
+	}
+	if s := p.scheduleOf(ev.conf); s != nil && !s.Open(time.Now()) {
+		return p.outsideWindow(msg, ev, s, target)
+	}
+	prov := p.providers.Pick(ev.conf.Smsconf)
+	seg := carrier.Lookup(target)
+	if reason := p.route(seg, ev.conf.Vendor, prov.Capabilities().Carriers); len(reason) > 0 {
+		detail := fmt.Sprintf("%s %s, vendor %d, provider %s", seg.Carrier, target, ev.conf.Vendor, prov.Name())
+		if reason == ReasonCarrierUnsupported && p.fallback(ev, seg, target, string(reason)) {
+			return nil
 		}
-	default:
-		log.Error("not support this routingkey")
+		p.skip(reason, ev, detail)
+		return nil
+	}
+	resp, outcome, err := p.publish(prov, ev, target)
+	if err == nil {
+		sent.Add(channelFlash, 1)
+		p.markSent(ev, target)
+		p.countQuota(ev)
+		p.track(prov, ev, target, resp)
+		log.Debug("send %s ok, provider %s, dry run %v", target, prov.Name(), p.dryRun(ev))
+		return nil
 	}
-	if len(target) == 0{
-		return "", fmt.Errorf("get phone failed")
+	log.Error("send %s, provider %s, %s, %s", target, prov.Name(), outcome, err.Error())
+	if outcome == provider.Retryable {
+		return p.retry(msg, ev, seg, target, err)
 	}
-	return target, nil
+	p.fallback(ev, seg, target, err.Error())
+	return nil
+}
 
+//dryRun tells whether the sends of ev are only logged
+func (p *Push) dryRun(ev *event) bool {
+	return p.DryRun || ev.conf.Sandbox
+}
 
+//route checks the carrier of a number against the networks the provider
+//reaches and the vcc's Vendor mask, 0 for every carrier. A number of an
+//unknown carrier is only sent with a 0 mask, as it was before carriers
+//were told apart.
+func (p *Push) route(seg carrier.Segment, vendor, reachable int) Reason {
+	if !carrier.ValidMask(vendor) {
+		return ReasonBadVendor
+	}
+	if seg.Carrier == carrier.Unknown {
+		if vendor != 0 {
+			return ReasonUnknownCarrier
+		}
+		return ""
+	}
+	if !seg.Host.In(reachable) {
+		return ReasonCarrierUnsupported
+	}
+	if vendor != 0 && !seg.Carrier.In(vendor) {
+		return ReasonVendor
+	}
+	return ""
+}
 
-	//if msg.RoutingKey == "msgproxy.1.21"{
-	//	err := json.Unmarshal(msg.Body, &m)
-	//	if err != nil{
-	//		return "", err
-	//	}
-	//	value := reflect.ValueOf(m.MSG)
-	//	if status := value.FieldByName("status");status != (reflect.Value{}){
-	//		s := status.String()
-	//		if s == "1"{
-	//			target = value.FieldByName("called").String()
-	//		}else if s == "5"{
-	//			target = value.FieldByName("trans_called").String()
-	//		}
-	//	}
-	//}else if msg.RoutingKey == "msgproxy.2.10"{
-	//	err := json.Unmarshal(msg.Body, &m)
-	//	if err != nil{
-	//		return "", err
-	//	}
-	//	value := reflect.ValueOf(m.MSG).Elem()
-	//	if status := value.FieldByName("call_sta");status != (reflect.Value{}){
-	//		s := status.String()
-	//		if s == "2"{
-	//			target = value.FieldByName("user_num").String()
-	//		}
-	//	}
-	//}else{
-	//	log.Error("not support this routingkey")
-	//}
-	//if len(target) == 0{
-	//	return "", fmt.Errorf("get phone failed")
-	//}
-	//return target, nil
+//checkVccid returns the enabled FlashSMS record of the event's vcc_id
+func (p *Push) checkVccid(m *Message) (*config.FlashSMS, error) {
+	strVccid, ok := rule.Field(m.MSG, "vcc_id")
+	if !ok {
+		return nil, errNoneVCCID
+	}
+	if len(strVccid) == 0 {
+		return nil, errWrongVCCID
+	}
+	id, err := strconv.Atoi(strVccid)
+	if err != nil {
+		return nil, errWrongVCCID
+	}
+	f, err := p.GetSmsConf(id)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Enable {
+		return nil, errVccidDisabled
+	}
+	return f, nil
 }
 
-func (p *Push) publish(m *SxMessage) error {
-	if len(m.Mobile) == 0 {
-		return fmt.Errorf("mobile number empty, %+v", m)
-	}
-	m.Caller = p.SxMessage.Caller
-	m.Operid = p.SxMessage.Operid
-	m.Sequenceid = time.Now().Format("20060102150405.999")
-	m.Sequenceid = m.Sequenceid + "_" + p.SxMessage.Operid
-	if len(p.SxMessage.Args) > 0 {
-		m.Args = p.SxMessage.Args
-	}
-	m.Tempid = p.SxMessage.Tempid
-	m.Enterid = p.SxMessage.Enterid
-	m.Enterpass = p.SxMessage.Enterpass
-	if len(m.MsgType) == 0 {
-		m.MsgType = "4"
-	}
-	fmt.Printf("加密前：%+v\n", m)
-	value := reflect.ValueOf(m).Elem()
-	l := value.NumField()
-	for i := 0; i < l; i++ {
-		v := value.Field(i).String()
-		if len(v) > 0 {
-			enc, err := encrypt.AESBase64Encrypt(v, p.key)
-			if err != nil {
-				return fmt.Errorf("%s, %+v", err.Error(), m)
-			}
-			value.Field(i).SetString(enc)
+func (p *Push) parseMessage(msg *amqp.Delivery) (*event, Reason, error) {
+	ev := &event{}
+	rules := p.GetRules()
+	key := broker.RoutingKey(msg)
+	if !rules.Has(key) {
+		return nil, ReasonNoRule, errNotSupportRoutingKey
+	}
+	err := json.Unmarshal(msg.Body, &ev.Message)
+	if err != nil {
+		return nil, ReasonBadPayload, err
+	}
+	if ev.conf, err = p.checkVccid(&ev.Message); err != nil {
+		switch err {
+		case errNoneVCCID, errWrongVCCID:
+			return nil, ReasonNoVccid, err
+		case errVccidDisabled:
+			return nil, ReasonDisabled, err
 		}
+		return nil, ReasonNoSmsConf, err
+	}
+	if ev.rule, ev.target, err = rules.Match(key, ev.MSG); err != nil {
+		return nil, ReasonNoTarget, errPhoneNoneExist
 	}
-	fmt.Printf("加密后：%+v\n", m)
-	buf, _ := json.Marshal(m)
-	return p.post(buf)
+	return ev, "", nil
 }
 
-func (p *Push) post(buf []byte) error {
-	resp, err := p.Post(p.url, "Content-Type:application/json", bytes.NewReader(buf))
+//request builds the provider request of ev, the FlashSMS record
+//overrides template and arguments of the provider when it sets them
+func (p *Push) request(prov provider.Provider, ev *event, target string) (*provider.Request, error) {
+	req := &provider.Request{Mobile: target, DryRun: p.dryRun(ev)}
+	if ev.conf.Tempid > 0 {
+		req.Tempid = strconv.Itoa(ev.conf.Tempid)
+	}
+	params := p.args[prov.Name()]
+	if len(strings.TrimSpace(ev.conf.Param)) > 0 {
+		var err error
+		if params, err = param.Parse(ev.conf.Param); err != nil {
+			return nil, fmt.Errorf("vcc_id %d param: %s", ev.conf.VccID, err.Error())
+		}
+	}
+	args, err := param.Resolve(params, ev.MSG)
 	if err != nil {
-		log.Error(err)
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	data, _ := ioutil.ReadAll(resp.Body)
+	req.Args = args
+	return req, nil
+}
 
-	var rep SxResponse
-	err = json.Unmarshal(data, &rep)
+//publish sends the flash of ev, a request that can't be built is a
+//permanent failure
+func (p *Push) publish(prov provider.Provider, ev *event, target string) (*provider.Response, provider.Outcome, error) {
+	req, err := p.request(prov, ev, target)
 	if err != nil {
-		log.Error("%s, %s", err.Error(), string(data))
-		return err
-	}
-	if rep.ResultCode != "200" {
-		log.Error(string(data))
-		return fmt.Errorf("%+v", rep)
+		return nil, provider.Permanent, err
 	}
-	return nil
+	start := time.Now()
+	resp, err := prov.Send(req)
+	p.record(prov, ev, req, resp, err, time.Since(start))
+	return resp, prov.Classify(resp, err), err
 }
@@ -4,41 +4,19 @@ import (
 	"encoding/json"
 	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sx/carrier"
 	"sx/config"
+	"sx/param"
+	"sx/provider"
+	_ "sx/provider/shanxin"
 	"testing"
+	"time"
 )
 
-func TestPush_Publish(t *testing.T) {
-	conf := config.NewConfig()
-	err := conf.Read("../conf.yml")
-	assert.NoError(t, err)
-	p, err := NewPusher(conf)
-	assert.NoError(t, err)
-
-	s := &SxMessage{
-		//Mobile:"11111111111",
-		Mobile: "13651694599",
-	}
-	err = p.publish(s)
-	assert.NoError(t, err)
-}
-
-func TestReflect(t *testing.T) {
-	m := &SxMessage{
-		Operid:    "7777",
-		Caller:    "123456",
-		Tempid:    "1222",
-		Enterid:   "dsewew23",
-		Enterpass: "sfwe3efsfds@~12",
-	}
-	value := reflect.ValueOf(m).Elem()
-	l := value.NumField()
-	assert.Equal(t, 9, l)
-	value.Field(0).SetString("aaaaaaaa")
-	assert.Equal(t, "aaaaaaaa", value.Field(0).String())
-}
-
 func TestReflectStruct(t *testing.T) {
 	d := `{
     "MainType":1,
@@ -70,45 +48,149 @@ func TestReflectStruct(t *testing.T) {
 }
 
 func TestParseMessage(t *testing.T) {
-	conf := config.NewConfig()
-	err := conf.Read("../conf.yml")
-	assert.NoError(t, err)
+	conf := testConf(t)
 
 	p, err := NewPusher(conf)
 	assert.NoError(t, err)
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
 
-	d := `{"MainType":1,"ExtType":21,"Mode":2,"ModeParm":"mcall-6522301381645316096","MSGID":"44252","TELID":"def","MSG":{"vcc_id":"782","call_id":"6522301381645316096","caller":"01057624343","called":"15201164261","trans_caller":"15201164261","trans_called":"7777","start_time":"1555037834","ring_time":"1555037834","answer_time":"1555037836","hangup_time":"1555037838","status":"8","user_data":{"test":123456}}}`
+	d := `{"MainType":1,"ExtType":21,"Mode":2,"ModeParm":"mcall-6522301381645316096","MSGID":"44252","TELID":"def","MSG":{"vcc_id":"782","call_id":"6522301381645316096","caller":"01057624343","called":"15201164261","trans_caller":"15201164261","trans_called":"7777","start_time":"1555037834","ring_time":"1555037834","answer_time":"1555037836","hangup_time":"1555037838","status":"1","user_data":{"test":123456}}}`
 	msg := amqp.Delivery{
 		RoutingKey: "msgproxy.1.21",
 		Body:       []byte(d),
 	}
 
-	str, err := p.parseMessage(&msg)
+	ev, _, err := p.parseMessage(&msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "15201164261", ev.target)
+
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: false})
+	_, reason, err := p.parseMessage(&msg)
+	assert.Equal(t, errVccidDisabled, err)
+	assert.Equal(t, ReasonDisabled, reason)
+}
+
+func TestRequest(t *testing.T) {
+	conf := testConf(t)
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	prov := p.providers.Pick(0)
+
+	ev := &event{
+		Message: Message{MSG: map[string]interface{}{
+			"called":     "13651694599",
+			"start_time": "1555037834",
+			"user_data":  map[string]interface{}{"ClientName": "icsoc", "agent": "8001"},
+		}},
+		conf: &config.FlashSMS{VccID: 782, Enable: true},
+	}
+	req, err := p.request(prov, ev, "13651694599")
+	assert.NoError(t, err)
+	assert.Equal(t, "", req.Tempid)
+	assert.Equal(t, []string{"icsoc"}, req.Args)
+
+	ev.conf = &config.FlashSMS{VccID: 782, Enable: true, Tempid: 5024, Param: "ClientName, user_data.agent, start_time|date"}
+	req, err = p.request(prov, ev, "13651694599")
 	assert.NoError(t, err)
-	assert.Equal(t, "15201164261", str)
+	assert.Equal(t, "5024", req.Tempid)
+	assert.Equal(t, []string{"icsoc", "8001", time.Unix(1555037834, 0).Format("2006-01-02")}, req.Args)
 
+	ev.conf.Param = "ClientName,user_data.extension"
+	_, err = p.request(prov, ev, "13651694599")
+	assert.Equal(t, &param.MissingError{Name: "user_data.extension"}, err)
 }
 
-func TestValid(t *testing.T) {
+func TestRoute(t *testing.T) {
 	p := Push{}
-	r, ta := p.valid("12345678900")
-	assert.Equal(t, true, r)
-	assert.Equal(t, "12345678900", ta)
+	reach := carrier.Mobile.Bit() | carrier.Unicom.Bit()
+	mobile := carrier.Lookup("13800138000")
+	unicom := carrier.Lookup("13000000000")
+	telecom := carrier.Lookup("13300000000")
+	virtualUnicom := carrier.Lookup("17090000000")
+	virtualTelecom := carrier.Lookup("17000000000")
+
+	assert.Equal(t, Reason(""), p.route(mobile, 0, reach))
+	assert.Equal(t, Reason(""), p.route(unicom, 0, reach))
+	assert.Equal(t, Reason(""), p.route(virtualUnicom, 0, reach))
+	assert.Equal(t, ReasonCarrierUnsupported, p.route(telecom, 0, reach))
+	assert.Equal(t, ReasonCarrierUnsupported, p.route(virtualTelecom, 0, reach))
+	assert.Equal(t, ReasonCarrierUnsupported, p.route(telecom, carrier.Telecom.Bit(), reach))
+	assert.Equal(t, Reason(""), p.route(carrier.Lookup("12345678900"), 0, reach))
+	assert.Equal(t, ReasonUnknownCarrier, p.route(carrier.Lookup("12345678900"), carrier.Mobile.Bit(), reach))
+	assert.Equal(t, ReasonBadVendor, p.route(mobile, 16, reach))
+	assert.Equal(t, ReasonBadVendor, p.route(mobile, -1, reach))
+
+	assert.Equal(t, Reason(""), p.route(mobile, carrier.Mobile.Bit(), reach))
+	assert.Equal(t, ReasonVendor, p.route(unicom, carrier.Mobile.Bit(), reach))
+	assert.Equal(t, ReasonVendor, p.route(virtualUnicom, carrier.Unicom.Bit(), reach))
+	assert.Equal(t, Reason(""), p.route(virtualUnicom, carrier.Virtual.Bit(), reach))
+}
 
-	r, _ = p.valid("123456789000")
-	assert.Equal(t, false, r)
+//panics is a provider failing with a panic, counted by panicSends
+type panics struct{}
 
-	r, _ = p.valid("0103456789000")
-	assert.Equal(t, false, r)
+var panicSends int
 
-	r, _ = p.valid("010345678900")
-	assert.Equal(t, false, r)
+func (panics) Name() string { return "panics" }
+func (panics) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Carriers: 0xf, Flash: true}
+}
+func (panics) Send(req *provider.Request) (*provider.Response, error) {
+	panicSends++
+	panic("send " + req.Mobile)
+}
+func (panics) Classify(resp *provider.Response, err error) provider.Outcome {
+	return provider.Permanent
+}
 
-	r, _ = p.valid("123456789a0")
-	assert.Equal(t, false, r)
+func init() {
+	provider.Register("panics", func(name string, conf *config.ProviderConf) (provider.Provider, error) {
+		return panics{}, nil
+	})
+}
 
-	r, ta = p.valid("012345678900")
-	assert.Equal(t, true, r)
-	assert.Equal(t, "12345678900", ta)
+func TestReadMsgPanic(t *testing.T) {
+	conf := testConf(t)
+	conf.Providers["shanxin"] = &config.ProviderConf{Type: "panics"}
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	p.sender = &sender{}
+
+	sends := panicSends
+	assert.NotPanics(t, func() {
+		assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	})
+	assert.Equal(t, sends+1, panicSends)
+}
 
+//TestNewPusherConf starts on the conf.yml shipped, its files are made
+//in a temporary directory
+func TestNewPusherConf(t *testing.T) {
+	file, err := filepath.Abs("../conf.yml")
+	assert.NoError(t, err)
+	dir, err := ioutil.TempDir("", "conf")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	conf := config.NewConfig()
+	assert.NoError(t, conf.Read(file))
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close())
+}
+
+//testConf reads conf.yml, quota counters and deferred events are kept
+//in memory, sends are not recorded
+func testConf(t *testing.T) *config.Config {
+	conf := config.NewConfig()
+	assert.NoError(t, conf.Read("../conf.yml"))
+	conf.QuotaFile = ""
+	conf.DeferDir = ""
+	conf.LedgerDir = ""
+	return conf
 }
@@ -0,0 +1,115 @@
+package push
+
+import (
+	"encoding/json"
+	"expvar"
+	log "github.com/alecthomas/log4go"
+	"github.com/streadway/amqp"
+	"net/http"
+	"strconv"
+	"sx/config"
+	"sx/quota"
+	"time"
+)
+
+//quotaWarnings counts soft threshold crossings by period
+var quotaWarnings = expvar.NewMap("quota_warnings")
+
+//QuotaWarning is the event published when a vcc crosses the soft
+//threshold of a quota
+type QuotaWarning struct {
+	VccID  int    `json:"vcc_id"`
+	Period string `json:"period"` //daily or monthly
+	Used   int    `json:"used"`
+	Limit  int    `json:"limit"`
+	Time   int64  `json:"time"`
+}
+
+func limitOf(f *config.FlashSMS) quota.Limit {
+	return quota.Limit{Daily: f.DailyQuota, Monthly: f.MonthlyQuota}
+}
+
+//countQuota counts a flash sent for the vcc of ev, fallback sms are
+//billed apart and not counted
+func (p *Push) countQuota(ev *event) {
+	before, after := p.quotas.Add(ev.conf.VccID)
+	l := limitOf(ev.conf)
+	for _, period := range l.Crossed(before, after, p.QuotaWarn) {
+		w := &QuotaWarning{VccID: ev.conf.VccID, Period: period, Used: after.Daily, Limit: l.Daily, Time: time.Now().Unix()}
+		if period == "monthly" {
+			w.Used, w.Limit = after.Monthly, l.Monthly
+		}
+		p.warnQuota(w)
+	}
+}
+
+//RunQuota writes the quota counters every QuotaFlush until done is closed
+func (p *Push) RunQuota(done <-chan struct{}) {
+	p.quotas.Run(p.QuotaFlush, done)
+}
+
+func (p *Push) warnQuota(w *QuotaWarning) {
+	quotaWarnings.Add(w.Period, 1)
+	log.Warn("vcc_id %d used %d of %s quota %d", w.VccID, w.Used, w.Period, w.Limit)
+	if len(p.QuotaWarnKey) == 0 || p.sender == nil {
+		return
+	}
+	body, _ := json.Marshal(w)
+	if err := p.sender.Publish(p.Exchange, p.QuotaWarnKey, amqp.Publishing{ContentType: "application/json", Body: body}); err != nil {
+		log.Error("publish quota warning, %s", err.Error())
+	}
+}
+
+//quotaReport is the quota of a vcc, remaining -1 for no limit
+type quotaReport struct {
+	VccID     int         `json:"vcc_id"`
+	Limit     quota.Limit `json:"limit"`
+	Usage     quota.Usage `json:"usage"`
+	Remaining quota.Limit `json:"remaining"`
+}
+
+func remaining(limit, used int) int {
+	if limit == 0 {
+		return -1
+	}
+	if used > limit {
+		return 0
+	}
+	return limit - used
+}
+
+func (p *Push) quotaReport(f *config.FlashSMS) *quotaReport {
+	r := &quotaReport{VccID: f.VccID, Limit: limitOf(f), Usage: p.quotas.Used(f.VccID)}
+	r.Remaining.Daily = remaining(r.Limit.Daily, r.Usage.Daily)
+	r.Remaining.Monthly = remaining(r.Limit.Monthly, r.Usage.Monthly)
+	return r
+}
+
+//serveQuota reports the quota of the vcc_id parameter, or of every vcc
+//having one
+func (p *Push) serveQuota(w http.ResponseWriter, r *http.Request) {
+	var v interface{}
+	if s := r.FormValue("vcc_id"); len(s) > 0 {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "bad vcc_id", http.StatusBadRequest)
+			return
+		}
+		f, err := p.GetSmsConf(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		v = p.quotaReport(f)
+	} else {
+		reports := []*quotaReport{}
+		for _, f := range p.SmsConfs() {
+			if f.DailyQuota > 0 || f.MonthlyQuota > 0 {
+				reports = append(reports, p.quotaReport(f))
+			}
+		}
+		v = reports
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,103 @@
+package push
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sx/config"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	assert.Equal(t, 0.8, conf.QuotaWarn)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.QuotaWarnKey = "sx.quota.warning"
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, DailyQuota: 5, MonthlyQuota: 100})
+	conf.SetSmsConf(&config.FlashSMS{VccID: 783, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	s := &sender{}
+	p.sender = s
+	before := count(skipped, string(ReasonQuota))
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	}
+	assert.Equal(t, 5, sends)
+	assert.Equal(t, before+1, count(skipped, string(ReasonQuota)))
+
+	//warned once at 4 of 5
+	assert.Equal(t, []string{"sx.quota.warning"}, s.keys)
+	var w QuotaWarning
+	assert.NoError(t, json.Unmarshal(s.msgs[0].Body, &w))
+	assert.Equal(t, QuotaWarning{VccID: 782, Period: "daily", Used: 4, Limit: 5, Time: w.Time}, w)
+
+	rec := httptest.NewRecorder()
+	p.serveQuota(rec, httptest.NewRequest("GET", "/quota?vcc_id=782", nil))
+	var r quotaReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+	assert.Equal(t, 5, r.Usage.Daily)
+	assert.Equal(t, 0, r.Remaining.Daily)
+	assert.Equal(t, 95, r.Remaining.Monthly)
+
+	rec = httptest.NewRecorder()
+	p.serveQuota(rec, httptest.NewRequest("GET", "/quota?vcc_id=783", nil))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+	assert.Equal(t, -1, r.Remaining.Daily)
+
+	//only vccs with a quota
+	rec = httptest.NewRecorder()
+	p.serveQuota(rec, httptest.NewRequest("GET", "/quota", nil))
+	var all []quotaReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &all))
+	assert.Equal(t, 1, len(all))
+	assert.Equal(t, 782, all[0].VccID)
+
+	rec = httptest.NewRecorder()
+	p.serveQuota(rec, httptest.NewRequest("GET", "/quota?vcc_id=1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSandbox(t *testing.T) {
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	assert.False(t, conf.DryRun)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, DailyQuota: 5, Sandbox: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	p.sender = &sender{}
+	before := count(sent, channelFlash)
+
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 0, sends)
+	assert.Equal(t, before+1, count(sent, channelFlash))
+	assert.Equal(t, 1, p.quotas.Used(782).Daily)
+
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, DailyQuota: 5})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, sends)
+
+	//global dry run
+	p.DryRun = true
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, sends)
+	assert.Equal(t, 3, p.quotas.Used(782).Daily)
+}
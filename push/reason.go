@@ -0,0 +1,62 @@
+package push
+
+import (
+	"expvar"
+	log "github.com/alecthomas/log4go"
+	"github.com/streadway/amqp"
+)
+
+//Reason is the code of why an event was not sent
+type Reason string
+
+const (
+	ReasonBadPayload         Reason = "bad_payload"
+	ReasonNoRule             Reason = "no_rule"
+	ReasonNoVccid            Reason = "no_vcc_id"
+	ReasonNoSmsConf          Reason = "no_sms_conf"
+	ReasonDisabled           Reason = "disabled"
+	ReasonNoTarget           Reason = "no_target"
+	ReasonMsgflag            Reason = "msgflag"
+	ReasonInvalidPhone       Reason = "invalid_phone"
+	ReasonUnknownCarrier     Reason = "unknown_carrier"
+	ReasonCarrierUnsupported Reason = "carrier_unsupported"
+	ReasonVendor             Reason = "vendor_mismatch"
+	ReasonBadVendor          Reason = "bad_vendor" //Vendor has bits of no carrier
+	ReasonDuplicate          Reason = "duplicate"
+	ReasonCapped             Reason = "frequency_cap"
+	ReasonQuota              Reason = "quota_exceeded"
+	ReasonQuietHours         Reason = "quiet_hours"
+	ReasonBlocked            Reason = "blocked"
+	ReasonPanic              Reason = "panic" //the handler panicked, see Push.ReadMsg
+)
+
+//skipped counts skipped events by reason, published by expvar
+var skipped = expvar.NewMap("skipped")
+
+//skip records an event dropped for reason, ev may be nil
+func (p *Push) skip(reason Reason, ev *event, detail string) {
+	skipped.Add(string(reason), 1)
+	vccID := 0
+	if ev != nil && ev.conf != nil {
+		vccID = ev.conf.VccID
+	}
+	log.Info("skip reason:%s vcc_id:%d %s", reason, vccID, detail)
+}
+
+//deadLettered counts dead lettered events by reason
+var deadLettered = expvar.NewMap("dead_lettered")
+
+//deadLetter keeps msg in the dead letter queue if reason is configured
+//for it. The error of a failed publish is returned, the consumer then
+//runs the handler again right away.
+func (p *Push) deadLetter(msg *amqp.Delivery, reason Reason, cause error) error {
+	if p.dead == nil || !p.deadFor[reason] {
+		return nil
+	}
+	if err := p.dead.Publish(p.sender, msg, string(reason), cause.Error()); err != nil {
+		log.Error("dead letter reason:%s, %s", reason, err.Error())
+		return err
+	}
+	deadLettered.Add(string(reason), 1)
+	return nil
+}
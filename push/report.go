@@ -0,0 +1,138 @@
+package push
+
+import (
+	"expvar"
+	log "github.com/alecthomas/log4go"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sx/dlr"
+	"sx/ledger"
+	"sx/provider"
+	"sx/redact"
+	"sx/rule"
+	"time"
+)
+
+//reportPath prefixes the report endpoint, followed by the provider name
+const reportPath = "/dlr/"
+
+//maxReportBody bounds the body of a report push
+const maxReportBody = 1 << 20
+
+//reports counts final states of sends, unmatched the reports of no
+//pending send
+var reports = expvar.NewMap("reports")
+
+//track holds a flash accepted by prov until its report, dry runs never
+//get one
+func (p *Push) track(prov provider.Provider, ev *event, target string, resp *provider.Response) {
+	if !p.tracks(prov, ev) || resp == nil || len(resp.Sequenceid) == 0 {
+		return
+	}
+	callID, _ := rule.Field(ev.MSG, "call_id")
+	p.reports.Track(&dlr.Send{
+		Sequenceid: resp.Sequenceid,
+		Provider:   prov.Name(),
+		VccID:      ev.conf.VccID,
+		CallID:     callID,
+		Mobile:     target,
+	})
+}
+
+//tracks tells whether the flashes of ev sent by prov await a report
+func (p *Push) tracks(prov provider.Provider, ev *event) bool {
+	if p.reports == nil || p.dryRun(ev) {
+		return false
+	}
+	_, ok := prov.(provider.Reporter)
+	return ok
+}
+
+//reload tracks again the sends the ledger records as pending, a restart
+//would lose them otherwise. Their mobiles are masked in the ledger.
+func (p *Push) reload() error {
+	entries, err := p.ledger.Query(ledger.Query{From: time.Now().Add(-p.DLRTimeout)})
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, e := range entries {
+		if e.State != string(dlr.Pending) || len(e.Sequenceid) == 0 {
+			continue
+		}
+		p.reports.Track(&dlr.Send{
+			Sequenceid: e.Sequenceid,
+			Provider:   e.Provider,
+			VccID:      e.VccID,
+			CallID:     e.CallID,
+			Mobile:     e.Mobile,
+			SentAt:     e.Time,
+		})
+		n++
+	}
+	log.Info("reports, %d pending sends reloaded from the ledger", n)
+	return nil
+}
+
+//finished is called with each send reaching a final state
+func (p *Push) finished(s *dlr.Send) {
+	reports.Add(string(s.State), 1)
+	log.Info("report vcc_id %d, call_id %s, %s, sequenceid %s, %s, %s", s.VccID, s.CallID, s.Mobile, s.Sequenceid, s.State, s.Desc)
+	if p.ledger != nil {
+		if err := p.ledger.Finish(s.Sequenceid, string(s.State), s.Desc, s.DoneAt); err != nil {
+			log.Error("ledger, %s", err.Error())
+		}
+	}
+}
+
+//serveReports takes the report pushes of a provider at /dlr/<provider>
+func (p *Push) serveReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, reportPath)
+	prov, ok := p.providers.Get(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rp, ok := prov.(provider.Reporter)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReportBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reps, err := rp.Reports(body)
+	if err != nil {
+		log.Error("report of %s, %s, %s", name, err.Error(), redact.Body(body))
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(rp.Ack(err))
+		return
+	}
+	for i := range reps {
+		if _, ok := p.reports.Report(&reps[i]); !ok {
+			reports.Add("unmatched", 1)
+			log.Warn("report of %s, sequenceid %s not pending, %s", name, reps[i].Sequenceid, reps[i].State)
+		}
+	}
+	w.Write(rp.Ack(nil))
+}
+
+//HandleReports registers the report endpoint on mux, sends are tracked
+//only if DLRAddr is configured
+func (p *Push) HandleReports(mux *http.ServeMux) {
+	mux.HandleFunc(reportPath, p.serveReports)
+}
+
+//RunReports expires sends without a report until done is closed
+func (p *Push) RunReports(done <-chan struct{}) {
+	if p.reports != nil {
+		p.reports.Run(done)
+	}
+}
@@ -0,0 +1,133 @@
+package push
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sx/config"
+	"sx/encrypt"
+	"sx/ledger"
+	"testing"
+	"time"
+)
+
+func TestReports(t *testing.T) {
+	conf := testConf(t)
+	key := conf.Providers["shanxin"].Key
+	var ids []string
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&m))
+		id, err := encrypt.AESBase64Decrypt(m["sequenceid"], key)
+		assert.NoError(t, err)
+		ids = append(ids, id)
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.DLRAddr = ":0"
+	conf.DLRTimeout = time.Hour
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	p.sender = &sender{}
+
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.NoError(t, p.ReadMsg(delivery("13800138001")))
+	assert.Equal(t, 2, p.reports.Len())
+	assert.Equal(t, 2, len(ids))
+
+	body, _ := json.Marshal(map[string]string{"sequenceid": enc(t, ids[0], key), "status": enc(t, "DELIVRD", key)})
+	mux := http.NewServeMux()
+	p.HandleReports(mux)
+	delivered := count(reports, "delivered")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/dlr/shanxin", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"resultCode":"200","resultDesc":"ok"}`, rec.Body.String())
+	assert.Equal(t, delivered+1, count(reports, "delivered"))
+	assert.Equal(t, 1, p.reports.Len())
+
+	//reported twice
+	unmatched := count(reports, "unmatched")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/dlr/shanxin", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, unmatched+1, count(reports, "unmatched"))
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/dlr/shanxin", strings.NewReader(`{"sequenceid":"x"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/dlr/nowhere", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/dlr/shanxin", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	//dry runs are not tracked
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Sandbox: true})
+	assert.NoError(t, p.ReadMsg(delivery("13800138002")))
+	assert.Equal(t, 1, p.reports.Len())
+}
+
+func TestReportsReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := testConf(t)
+	key := conf.Providers["shanxin"].Key
+	var ids []string
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&m))
+		id, _ := encrypt.AESBase64Decrypt(m["sequenceid"], key)
+		ids = append(ids, id)
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.LedgerDir = dir
+	conf.LedgerSecret = "salt"
+	conf.LedgerRetention = time.Hour
+	conf.DLRAddr = ":0"
+	conf.DLRTimeout = time.Hour
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	p.sender = &sender{}
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.NoError(t, p.ReadMsg(delivery("13800138001")))
+	assert.NoError(t, p.Close())
+
+	//restarted, one report came in meanwhile
+	l, err := ledger.Open(dir, time.Hour, "salt")
+	assert.NoError(t, err)
+	assert.NoError(t, l.Finish(ids[1], "delivered", "DELIVRD", time.Now()))
+	assert.NoError(t, l.Close())
+	p, err = NewPusher(conf)
+	assert.NoError(t, err)
+	defer p.Close()
+	assert.Equal(t, 1, p.reports.Len())
+
+	mux := http.NewServeMux()
+	p.HandleReports(mux)
+	body, _ := json.Marshal(map[string]string{"sequenceid": enc(t, ids[0], key), "status": enc(t, "DELIVRD", key)})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/dlr/shanxin", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, p.reports.Len())
+	e, err := p.ledger.Query(ledger.Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, "delivered", e[0].State)
+	assert.Equal(t, "delivered", e[1].State)
+}
@@ -0,0 +1,47 @@
+package push
+
+import (
+	"expvar"
+	log "github.com/alecthomas/log4go"
+	"github.com/streadway/amqp"
+	"sx/broker"
+	"sx/carrier"
+)
+
+//retried counts retryable failures: scheduled, parked, failed to
+//republish and dropped with retry disabled
+var retried = expvar.NewMap("retried")
+
+//retry schedules msg again after a retryable send failure. The error of
+//a failed republish is returned, the consumer then runs the handler
+//again right away. The vcc's fallback is sent once msg is parked or
+//dropped with retry disabled.
+func (p *Push) retry(msg *amqp.Delivery, ev *event, seg carrier.Segment, target string, cause error) error {
+	if p.retries == nil {
+		retried.Add("dropped", 1)
+		log.Warn("retry disabled, drop vcc_id:%d %s", ev.conf.VccID, target)
+		p.fallback(ev, seg, target, cause.Error())
+		return nil
+	}
+	attempt, parked, err := p.retries.Republish(p.sender, msg, cause.Error())
+	if err != nil {
+		retried.Add("failed", 1)
+		log.Error("republish vcc_id:%d %s, %s", ev.conf.VccID, target, err.Error())
+		return err
+	}
+	if parked {
+		retried.Add("parked", 1)
+		log.Warn("park vcc_id:%d %s after %d retries, %s", ev.conf.VccID, target, attempt, cause.Error())
+		p.fallback(ev, seg, target, cause.Error())
+		return nil
+	}
+	retried.Add("scheduled", 1)
+	log.Info("retry vcc_id:%d %s, attempt %d in %s", ev.conf.VccID, target, attempt, p.retries.TTL(attempt))
+	return nil
+}
+
+//Replay handles a parked delivery again with a fresh retry budget
+func (p *Push) Replay(msg *amqp.Delivery) error {
+	delete(msg.Headers, broker.HeaderAttempt)
+	return p.ReadMsg(msg)
+}
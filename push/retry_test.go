@@ -0,0 +1,130 @@
+package push
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sx/broker"
+	"sx/config"
+	"testing"
+	"time"
+)
+
+type sender struct {
+	keys []string
+	msgs []amqp.Publishing
+	err  error
+}
+
+func (s *sender) Publish(exchange, key string, msg amqp.Publishing) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.keys = append(s.keys, key)
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	code := http.StatusBadGateway
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.WriteHeader(code)
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	assert.Equal(t, 10*time.Second, conf.RetryDelay)
+	assert.Equal(t, conf.QueueName+".parking", conf.ParkingQueue)
+	conf.RetryMax = 0
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	assert.Nil(t, p.retries)
+
+	//disabled, dropped
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+
+	s := &sender{}
+	p.retries = &broker.Retry{Queue: "q", Exchange: "q.retry", Parking: "q.parking", Max: 2, Delay: time.Second}
+	p.sender = s
+	scheduled, parked := count(retried, "scheduled"), count(retried, "parked")
+
+	d := delivery("13800138000")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.ReadMsg(d))
+		//back from the delay queue
+		d = &amqp.Delivery{RoutingKey: "q", Body: s.msgs[i].Body, Headers: s.msgs[i].Headers}
+	}
+	assert.Equal(t, []string{"q.delay.1s", "q.delay.2s", "q.parking"}, s.keys)
+	assert.Equal(t, scheduled+2, count(retried, "scheduled"))
+	assert.Equal(t, parked+1, count(retried, "parked"))
+
+	//replayed from parking with a fresh budget, and succeeds
+	code = http.StatusOK
+	sends = 0
+	assert.NoError(t, p.Replay(&amqp.Delivery{Body: s.msgs[2].Body, Headers: s.msgs[2].Headers}))
+	assert.Equal(t, 1, sends)
+	assert.Equal(t, 3, len(s.keys))
+
+	//republish failure is returned for the consumer to retry
+	code = http.StatusServiceUnavailable
+	s.err = errors.New("closed")
+	assert.Error(t, p.ReadMsg(delivery("13800138000")))
+
+	//permanent failures are not retried
+	code = http.StatusBadRequest
+	s.err = nil
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 3, len(s.keys))
+}
+
+func TestDeadLetter(t *testing.T) {
+	conf := testConf(t)
+	assert.Equal(t, conf.QueueName+".dlx", conf.DeadExchange)
+	conf.RetryMax = 0
+	conf.DeadQueue = "q.dlq"
+	conf.DeadReasons = []string{"bad_payload", "no_vcc_id"}
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	s := &sender{}
+	p.sender = s
+	before := count(deadLettered, "bad_payload")
+
+	assert.NoError(t, p.ReadMsg(&amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte(`{"MSG":`)}))
+	assert.NoError(t, p.ReadMsg(&amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte(`{"MSG":{"called":"13800138000"}}`)}))
+	//no_sms_conf is not configured
+	assert.NoError(t, p.ReadMsg(&amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte(`{"MSG":{"vcc_id":"1"}}`)}))
+	assert.Equal(t, 2, len(s.msgs))
+	assert.Equal(t, "bad_payload", s.msgs[0].Headers[broker.HeaderReason])
+	assert.Equal(t, "no_vcc_id", s.msgs[1].Headers[broker.HeaderReason])
+	assert.Equal(t, "msgproxy.1.21", s.msgs[1].Headers[broker.HeaderRoutingKey])
+	assert.Equal(t, before+1, count(deadLettered, "bad_payload"))
+
+	s.err = errors.New("closed")
+	assert.Error(t, p.ReadMsg(&amqp.Delivery{RoutingKey: "msgproxy.1.21", Body: []byte(`x`)}))
+}
+
+func TestDeadLetterPanic(t *testing.T) {
+	conf := testConf(t)
+	conf.RetryMax = 0
+	conf.DeadQueue = "q.dlq"
+	conf.DeadReasons = []string{"panic"}
+	conf.Providers["shanxin"] = &config.ProviderConf{Type: "panics"}
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true})
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	s := &sender{}
+	p.sender = s
+
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, len(s.msgs))
+	assert.Equal(t, "panic", s.msgs[0].Headers[broker.HeaderReason])
+	assert.Equal(t, "panic: send 13800138000", s.msgs[0].Headers[broker.HeaderError])
+}
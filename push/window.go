@@ -0,0 +1,87 @@
+package push
+
+import (
+	"expvar"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"github.com/streadway/amqp"
+	"sx/broker"
+	"sx/config"
+	"sx/deferred"
+	"sx/window"
+	"sync"
+	"time"
+)
+
+//outsideDefer is the FlashSMS.Outside value deferring events
+const outsideDefer = "defer"
+
+//deferredCount counts events deferred to a send window
+var deferredCount = expvar.NewInt("deferred")
+
+//schedules caches the parsed send windows of vccs by time zone and
+//windows, bad ones are kept with their error so they are logged once
+type schedules struct {
+	lock  sync.Mutex
+	byDef map[string]parsedSchedule
+}
+
+type parsedSchedule struct {
+	s   *window.Schedule
+	err error
+}
+
+//scheduleOf returns the send windows of a vcc, nil if it has none or
+//they can't be parsed
+func (p *Push) scheduleOf(f *config.FlashSMS) *window.Schedule {
+	if len(f.Windows) == 0 {
+		return nil
+	}
+	key := f.Timezone + "|" + f.Windows
+	p.schedules.lock.Lock()
+	defer p.schedules.lock.Unlock()
+	c, ok := p.schedules.byDef[key]
+	if !ok {
+		c.s, c.err = window.Parse(f.Windows, f.Timezone)
+		if c.err != nil {
+			log.Error("vcc_id %d windows %q, %s, always open", f.VccID, f.Windows, c.err.Error())
+		}
+		if p.schedules.byDef == nil {
+			p.schedules.byDef = make(map[string]parsedSchedule)
+		}
+		p.schedules.byDef[key] = c
+	}
+	return c.s
+}
+
+//outsideWindow drops msg, or holds it until the next window opens. The
+//error of a failed deferral is returned for the consumer to retry.
+func (p *Push) outsideWindow(msg *amqp.Delivery, ev *event, s *window.Schedule, target string) error {
+	if ev.conf.Outside != outsideDefer {
+		p.skip(ReasonQuietHours, ev, target)
+		return nil
+	}
+	due := s.Next(time.Now())
+	err := p.deferred.Add(&deferred.Item{Due: due, RoutingKey: broker.RoutingKey(msg), Body: msg.Body})
+	if err != nil {
+		log.Error("defer vcc_id:%d %s, %s", ev.conf.VccID, target, err.Error())
+		return err
+	}
+	deferredCount.Add(1)
+	log.Info("defer vcc_id:%d %s until %s", ev.conf.VccID, target, due.Format(time.RFC3339))
+	return nil
+}
+
+//release handles a deferred event once its window opened
+func (p *Push) release(it *deferred.Item) error {
+	if err := p.ReadMsg(&amqp.Delivery{RoutingKey: it.RoutingKey, Body: it.Body}); err != nil {
+		return fmt.Errorf("release %s, %s", it.ID, err.Error())
+	}
+	return nil
+}
+
+//RunDeferred handles deferred events as their windows open until done
+//is closed
+func (p *Push) RunDeferred(done <-chan struct{}) {
+	p.deferred.Run(p.release, done)
+}
@@ -0,0 +1,69 @@
+package push
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sx/config"
+	"sx/deferred"
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	sends := 0
+	flash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+		w.Write([]byte(`{"resultCode":"200"}`))
+	}))
+	defer flash.Close()
+
+	conf := testConf(t)
+	conf.Providers["shanxin"].URL = flash.URL
+	conf.Caps = ""
+	p, err := NewPusher(conf)
+	assert.NoError(t, err)
+	//a window opening in two hours
+	now := time.Now().UTC()
+	closed := fmt.Sprintf("%02d:00-%02d:00", (now.Hour()+2)%24, (now.Hour()+3)%24)
+	before := count(skipped, string(ReasonQuietHours))
+
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Windows: "00:00-24:00", Timezone: "UTC"})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, sends)
+
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Windows: closed, Timezone: "UTC"})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, sends)
+	assert.Equal(t, before+1, count(skipped, string(ReasonQuietHours)))
+	assert.Equal(t, 0, p.deferred.Len())
+
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Windows: closed, Timezone: "UTC", Outside: "defer"})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 1, sends)
+	assert.Equal(t, 1, p.deferred.Len())
+
+	next := p.deferred.Due(func(it *deferred.Item) error {
+		t.Fatal("released before the window opens")
+		return nil
+	})
+	assert.Equal(t, 2*time.Hour, next.Sub(now.Truncate(time.Hour)))
+
+	//the window opened
+	assert.NoError(t, p.deferred.Add(&deferred.Item{Due: time.Now(), RoutingKey: "msgproxy.1.21", Body: delivery("13800138000").Body}))
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Windows: "00:00-24:00", Timezone: "UTC", Outside: "defer"})
+	p.deferred.Due(p.release)
+	assert.Equal(t, 2, sends)
+	assert.Equal(t, 1, p.deferred.Len())
+
+	//bad windows are ignored
+	conf.SetSmsConf(&config.FlashSMS{VccID: 782, Enable: true, Windows: "never"})
+	assert.NoError(t, p.ReadMsg(delivery("13800138000")))
+	assert.Equal(t, 3, sends)
+	//remembered with its error, and kept by p only
+	assert.Error(t, p.schedules.byDef["|never"].err)
+	q, err := NewPusher(conf)
+	assert.NoError(t, err)
+	assert.Empty(t, q.schedules.byDef)
+}
@@ -0,0 +1,191 @@
+package quota
+
+import (
+	"encoding/json"
+	log "github.com/alecthomas/log4go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//Usage is what a vcc sent in the current day and month
+type Usage struct {
+	Day     string `json:"day"` //20060102
+	Daily   int    `json:"daily"`
+	Month   string `json:"month"` //200601
+	Monthly int    `json:"monthly"`
+}
+
+//Limit is the quota of a vcc, 0 for no limit
+type Limit struct {
+	Daily   int `json:"daily"`
+	Monthly int `json:"monthly"`
+}
+
+//Exceeded returns the period whose limit u reached, empty if none
+func (l Limit) Exceeded(u Usage) string {
+	if l.Daily > 0 && u.Daily >= l.Daily {
+		return "daily"
+	}
+	if l.Monthly > 0 && u.Monthly >= l.Monthly {
+		return "monthly"
+	}
+	return ""
+}
+
+//Crossed returns the periods whose soft threshold, ratio of the limit,
+//the send taking before to after crossed
+func (l Limit) Crossed(before, after Usage, ratio float64) []string {
+	var periods []string
+	cross := func(limit, b, a int) bool {
+		th := int(float64(limit)*ratio + 0.5)
+		return limit > 0 && b < th && a >= th
+	}
+	if cross(l.Daily, before.Daily, after.Daily) {
+		periods = append(periods, "daily")
+	}
+	if cross(l.Monthly, before.Monthly, after.Monthly) {
+		periods = append(periods, "monthly")
+	}
+	return periods
+}
+
+//Counter counts sends of each vcc, a counter with a file persists the
+//counts so they survive restarts. Changes are written by Flush, run
+//every interval by Run and on Close, so a crash loses the sends counted
+//since the last flush.
+type Counter struct {
+	lock   sync.Mutex
+	file   string
+	counts map[int]*Usage
+	dirty  bool
+	now    func() time.Time
+
+	saveLock sync.Mutex //orders the writes of Flush
+}
+
+//Open loads the counts of file, a missing file starts from zero and an
+//empty name keeps counts in memory only
+func Open(file string) (*Counter, error) {
+	c := &Counter{file: file, counts: make(map[int]*Usage), now: time.Now}
+	if len(file) == 0 {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &c.counts); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//Used returns the usage of vcc in the current periods
+func (c *Counter) Used(vcc int) Usage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.current(vcc)
+}
+
+//Add counts a send of vcc and returns the usage before and after
+func (c *Counter) Add(vcc int) (before, after Usage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	before = c.current(vcc)
+	after = before
+	after.Daily++
+	after.Monthly++
+	c.counts[vcc] = &after
+	c.dirty = true
+	return before, after
+}
+
+//current returns the usage of vcc, reset when a period has passed
+func (c *Counter) current(vcc int) Usage {
+	now := c.now()
+	day, month := now.Format("20060102"), now.Format("200601")
+	u := Usage{Day: day, Month: month}
+	if p, ok := c.counts[vcc]; ok {
+		u = *p
+	}
+	if u.Day != day {
+		u.Day, u.Daily = day, 0
+	}
+	if u.Month != month {
+		u.Month, u.Monthly = month, 0
+	}
+	return u
+}
+
+//Flush writes the counts if they changed since the last flush
+func (c *Counter) Flush() error {
+	if len(c.file) == 0 {
+		return nil
+	}
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+	c.lock.Lock()
+	if !c.dirty {
+		c.lock.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.counts)
+	c.dirty = false
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = c.save(data); err != nil {
+		c.lock.Lock()
+		c.dirty = true
+		c.lock.Unlock()
+	}
+	return err
+}
+
+//Run flushes the counts every interval until done is closed
+func (c *Counter) Run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+		if err := c.Flush(); err != nil {
+			log.Error("quota flush, %s", err.Error())
+		}
+	}
+}
+
+//Close flushes the counts
+func (c *Counter) Close() error {
+	return c.Flush()
+}
+
+//save writes data to a temporary file renamed over file, a crash
+//leaves either the old or the new counts
+func (c *Counter) save(data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(c.file), filepath.Base(c.file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file)
+}
@@ -0,0 +1,61 @@
+package quota
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCounter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quota")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "quota.json")
+
+	now := time.Date(2026, 10, 31, 23, 0, 0, 0, time.Local)
+	c, err := Open(file)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		c.Add(782)
+	}
+	before, after := c.Add(782)
+	assert.Equal(t, Usage{Day: "20261031", Daily: 3, Month: "202610", Monthly: 3}, before)
+	assert.Equal(t, 4, after.Daily)
+	//not written until flushed
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, c.Close())
+
+	//reopened after a restart
+	c, err = Open(file)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return now }
+	assert.Equal(t, Usage{Day: "20261031", Daily: 4, Month: "202610", Monthly: 4}, c.Used(782))
+	assert.Equal(t, Usage{Day: "20261031", Month: "202610"}, c.Used(1))
+
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, Usage{Day: "20261101", Month: "202611"}, c.Used(782))
+	//reading doesn't change the counts
+	assert.Equal(t, 1, len(c.counts))
+	assert.False(t, c.dirty)
+
+	_, err = Open(dir)
+	assert.Error(t, err)
+}
+
+func TestLimit(t *testing.T) {
+	l := Limit{Daily: 10, Monthly: 100}
+	assert.Equal(t, "", l.Exceeded(Usage{Daily: 9, Monthly: 99}))
+	assert.Equal(t, "daily", l.Exceeded(Usage{Daily: 10, Monthly: 10}))
+	assert.Equal(t, "monthly", l.Exceeded(Usage{Daily: 1, Monthly: 100}))
+	assert.Equal(t, "", Limit{}.Exceeded(Usage{Daily: 1000, Monthly: 1000}))
+
+	assert.Equal(t, []string{"daily"}, l.Crossed(Usage{Daily: 7, Monthly: 7}, Usage{Daily: 8, Monthly: 8}, 0.8))
+	assert.Nil(t, l.Crossed(Usage{Daily: 8, Monthly: 8}, Usage{Daily: 9, Monthly: 9}, 0.8))
+	assert.Equal(t, []string{"daily", "monthly"}, l.Crossed(Usage{Daily: 7, Monthly: 79}, Usage{Daily: 8, Monthly: 80}, 0.8))
+	assert.Nil(t, Limit{}.Crossed(Usage{}, Usage{Daily: 1}, 0.8))
+}
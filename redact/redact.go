@@ -0,0 +1,143 @@
+//Package redact keeps secrets and full mobiles out of the logs
+package redact
+
+import (
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"regexp"
+	"strings"
+	"sx/phone"
+	"sync"
+)
+
+//Redacted replaces a secret in a log line
+const Redacted = "***"
+
+//MinSecret is the shortest secret replaced, shorter ones would mask
+//ordinary text
+const MinSecret = 4
+
+//MaxBody is the most of a request or message body logged by Body
+const MaxBody = 512
+
+var (
+	lock     sync.RWMutex
+	secrets  = make(map[string]bool)
+	replacer = strings.NewReplacer()
+
+	//runs are digits and the separators phone.Normalize takes
+	runs = regexp.MustCompile(`\+?[0-9](?:[0-9 \t\-.()（）　]*[0-9])?`)
+)
+
+//maxNumber is the longest number tried in a run, ie: +86 (138) 0013-8000
+const maxNumber = 24
+
+//Add registers secrets to be replaced by Redacted
+func Add(s ...string) {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, v := range s {
+		if len(v) >= MinSecret {
+			secrets[v] = true
+		}
+	}
+	pairs := make([]string, 0, len(secrets)*2)
+	for v := range secrets {
+		pairs = append(pairs, v, Redacted)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+//Mask hides the middle of a mobile, ie: 138****8000
+func Mask(mobile string) string {
+	if len(mobile) < 7 {
+		return strings.Repeat("*", len(mobile))
+	}
+	return mobile[:3] + strings.Repeat("*", len(mobile)-7) + mobile[len(mobile)-4:]
+}
+
+//String returns s with the registered secrets and the mobiles masked,
+//mobiles are found as phone.Normalize takes them, ie: +86 138 0013 8000
+func String(s string) string {
+	lock.RLock()
+	r := replacer
+	lock.RUnlock()
+	s = r.Replace(s)
+	return runs.ReplaceAllStringFunc(s, maskRun)
+}
+
+//maskRun masks the mobiles of a run, a mobile spans whole groups of
+//digits and the longest one from each group is taken
+func maskRun(run string) string {
+	var starts, ends []int
+	for i := 0; i < len(run); i++ {
+		if run[i] < '0' || run[i] > '9' {
+			continue
+		}
+		j := i
+		for j < len(run) && run[j] >= '0' && run[j] <= '9' {
+			j++
+		}
+		starts, ends = append(starts, i), append(ends, j)
+		i = j
+	}
+	if run[0] == '+' {
+		starts[0] = 0
+	}
+	b := []byte(run)
+	for i := 0; i < len(starts); i++ {
+		for j := len(ends) - 1; j >= i; j-- {
+			if ends[j]-starts[i] > maxNumber {
+				continue
+			}
+			if _, err := phone.Normalize(run[starts[i]:ends[j]]); err == nil {
+				maskMobile(b[starts[i]:ends[j]])
+				i = j
+				break
+			}
+		}
+	}
+	return string(b)
+}
+
+//maskMobile hides the digits of number as Mask does, the mobile is its
+//last 11 digits
+func maskMobile(number []byte) {
+	n := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			continue
+		}
+		if n++; n > 4 && n <= 8 {
+			number[i] = '*'
+		}
+	}
+}
+
+//Body returns b for a log line, cut to MaxBody bytes and redacted
+func Body(b []byte) string {
+	if len(b) <= MaxBody {
+		return String(string(b))
+	}
+	return fmt.Sprintf("%s...(%d bytes)", String(string(b[:MaxBody])), len(b))
+}
+
+//Writer redacts each record before passing it to a log4go writer
+type Writer struct {
+	log.LogWriter
+}
+
+//LogWrite implements log4go.LogWriter
+func (w Writer) LogWrite(rec *log.LogRecord) {
+	rec.Message = String(rec.Message)
+	w.LogWriter.LogWrite(rec)
+}
+
+//Install wraps the writers of logger, ie: log4go.Global
+func Install(logger log.Logger) {
+	for _, f := range logger {
+		if _, ok := f.LogWriter.(Writer); !ok {
+			f.LogWriter = Writer{f.LogWriter}
+		}
+	}
+}
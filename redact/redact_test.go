@@ -0,0 +1,59 @@
+package redact
+
+import (
+	log "github.com/alecthomas/log4go"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	Add("hg62159393", "pw", "s3cret")
+	assert.Equal(t, "key=*** pass=pw ***", String("key=hg62159393 pass=pw s3cret"))
+	assert.Equal(t, "mobile 138****8000, 86138****8000", String("mobile 13800138000, 8613800138000"))
+	assert.Equal(t, "seq 2026101712000000000010001 tel 01057624343 12800138000",
+		String("seq 2026101712000000000010001 tel 01057624343 12800138000"))
+	//the forms phone.Normalize takes
+	for in, out := range map[string]string{
+		"013619289103":      "0136****9103",
+		"+86 138 0013 8000": "+86 138 **** 8000",
+		"138-0013-8000":     "138-****-8000",
+		"008613800138000":   "0086138****8000",
+		"(138) 0013-8000":   "(138) ****-8000",
+		"13800138000#123":   "138****8000#123",
+	} {
+		assert.Equal(t, "called "+out+".", String("called "+in+"."), in)
+	}
+	assert.Equal(t, "vcc 782 138****8000 138****8001", String("vcc 782 13800138000 13800138001"))
+	assert.Equal(t, "2026-10-17 12:00:00", String("2026-10-17 12:00:00"))
+}
+
+func TestBody(t *testing.T) {
+	assert.Equal(t, `{"mobile":"138****8000"}`, Body([]byte(`{"mobile":"13800138000"}`)))
+	long := Body([]byte(strings.Repeat("a", MaxBody+100)))
+	assert.Equal(t, strings.Repeat("a", MaxBody)+"...(612 bytes)", long)
+}
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "138****8000", Mask("13800138000"))
+	assert.Equal(t, "123***7890", Mask("1234567890"))
+	assert.Equal(t, "***", Mask("123"))
+}
+
+type recorder struct {
+	msgs []string
+}
+
+func (r *recorder) LogWrite(rec *log.LogRecord) { r.msgs = append(r.msgs, rec.Message) }
+func (r *recorder) Close()                      {}
+
+func TestInstall(t *testing.T) {
+	Add("topsecret")
+	rec := &recorder{}
+	l := make(log.Logger)
+	l.AddFilter("rec", log.DEBUG, rec)
+	Install(l)
+	Install(l)
+	l.Info("send %s to %s", "topsecret", "13800138000")
+	assert.Equal(t, []string{"send *** to 138****8000"}, rec.msgs)
+}
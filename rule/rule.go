@@ -0,0 +1,166 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrNoRule   = errors.New("no rule for this routingkey")
+	ErrNoMatch  = errors.New("no rule matched")
+	ErrNoTarget = errors.New("target field empty")
+)
+
+//Kind is an event kind, each kind is one bit of FlashSMS.Msgflag
+type Kind int
+
+const (
+	InboundMissed Kind = 1 << iota
+	InboundAnswered
+	TransferAnswered
+	TransferMissed
+	OutboundFinished
+)
+
+var kinds = map[string]Kind{
+	"inbound_missed":    InboundMissed,
+	"inbound_answered":  InboundAnswered,
+	"transfer_answered": TransferAnswered,
+	"transfer_missed":   TransferMissed,
+	"outbound_finished": OutboundFinished,
+}
+
+//In reports whether the kind bit is set in msgflag, 0 enables every kind
+func (k Kind) In(msgflag int) bool {
+	return msgflag == 0 || msgflag&int(k) != 0
+}
+
+//Rule tells which MSG field holds the phone to flash for a call event.
+//A rule applies when the routing key is equal and every When condition
+//matches the MSG field of the same name, ie:
+//  routingKey: msgproxy.1.21
+//  when: {status: "5"}
+//  target: trans_called
+type Rule struct {
+	Name       string            `json:"name" mapstructure:"name"`
+	RoutingKey string            `json:"routingKey" mapstructure:"routingKey"`
+	When       map[string]string `json:"when" mapstructure:"when"`
+	Target     string            `json:"target" mapstructure:"target"`
+	Kind       string            `json:"kind" mapstructure:"kind"` //event kind, gated by Msgflag
+}
+
+//Allowed reports whether a vcc with msgflag wants this event,
+//a rule without kind is always allowed
+func (r *Rule) Allowed(msgflag int) bool {
+	if len(r.Kind) == 0 {
+		return true
+	}
+	return kinds[r.Kind].In(msgflag)
+}
+
+//Set is an ordered rule list, the first matched rule wins
+type Set []*Rule
+
+//Parse decodes a json rule array, ie: the value stored in etcd
+func Parse(data []byte) (Set, error) {
+	var s Set
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//Validate checks every rule has a routing key and a target field
+func (s Set) Validate() error {
+	for i, r := range s {
+		if r == nil {
+			return fmt.Errorf("rule %d: empty", i)
+		}
+		if len(r.RoutingKey) == 0 {
+			return fmt.Errorf("rule %d %s: routingKey empty", i, r.Name)
+		}
+		if len(r.Target) == 0 {
+			return fmt.Errorf("rule %d %s: target empty", i, r.Name)
+		}
+		if _, ok := kinds[r.Kind]; len(r.Kind) > 0 && !ok {
+			return fmt.Errorf("rule %d %s: unknown kind %s", i, r.Name, r.Kind)
+		}
+	}
+	return nil
+}
+
+//RoutingKeys returns the distinct routing keys to bind, in rule order
+func (s Set) RoutingKeys() []string {
+	keys := make([]string, 0, len(s))
+	seen := make(map[string]bool, len(s))
+	for _, r := range s {
+		if !seen[r.RoutingKey] {
+			seen[r.RoutingKey] = true
+			keys = append(keys, r.RoutingKey)
+		}
+	}
+	return keys
+}
+
+//Has reports whether any rule handles routingKey
+func (s Set) Has(routingKey string) bool {
+	for _, r := range s {
+		if r.RoutingKey == routingKey {
+			return true
+		}
+	}
+	return false
+}
+
+//Match returns the first rule matching the event and the target phone
+func (s Set) Match(routingKey string, msg map[string]interface{}) (*Rule, string, error) {
+	if !s.Has(routingKey) {
+		return nil, "", ErrNoRule
+	}
+	for _, r := range s {
+		if r.RoutingKey != routingKey || !r.matches(msg) {
+			continue
+		}
+		target, _ := Field(msg, r.Target)
+		if len(target) == 0 {
+			return r, "", ErrNoTarget
+		}
+		return r, target, nil
+	}
+	return nil, "", ErrNoMatch
+}
+
+func (r *Rule) matches(msg map[string]interface{}) bool {
+	for k, want := range r.When {
+		v, ok := Field(msg, k)
+		if !ok || v != want {
+			return false
+		}
+	}
+	return true
+}
+
+//Field returns the MSG field as string, msgproxy sends most values as
+//strings but json numbers and bools are accepted too
+func Field(msg map[string]interface{}, name string) (string, bool) {
+	v, ok := msg[name]
+	if !ok || v == nil {
+		return "", false
+	}
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case json.Number:
+		return t.String(), true
+	case bool:
+		return strconv.FormatBool(t), true
+	}
+	return "", false
+}
@@ -0,0 +1,78 @@
+package rule
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var rules = `[
+{"name":"missed","routingKey":"msgproxy.1.21","when":{"status":"1"},"target":"called","kind":"inbound_missed"},
+{"name":"trans","routingKey":"msgproxy.1.21","when":{"status":"5"},"target":"trans_called","kind":"transfer_answered"},
+{"name":"outbound","routingKey":"msgproxy.2.10","when":{"call_sta":"2"},"target":"user_num"}
+]`
+
+func msg(t *testing.T, d string) map[string]interface{} {
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(d), &m))
+	return m
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(rules))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(s))
+	assert.Equal(t, []string{"msgproxy.1.21", "msgproxy.2.10"}, s.RoutingKeys())
+
+	_, err = Parse([]byte(`[{"routingKey":"msgproxy.1.21"}]`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`[{"target":"called"}]`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`[{"routingKey":"msgproxy.1.21","target":"called","kind":"nope"}]`))
+	assert.Error(t, err)
+}
+
+func TestAllowed(t *testing.T) {
+	s, err := Parse([]byte(rules))
+	assert.NoError(t, err)
+	missed, trans, outbound := s[0], s[1], s[2]
+
+	assert.True(t, missed.Allowed(0))
+	assert.True(t, trans.Allowed(0))
+
+	flag := int(InboundMissed | OutboundFinished)
+	assert.True(t, missed.Allowed(flag))
+	assert.False(t, trans.Allowed(flag))
+	assert.True(t, trans.Allowed(int(TransferAnswered)))
+
+	//no kind, never gated
+	assert.True(t, outbound.Allowed(int(TransferAnswered)))
+}
+
+func TestMatch(t *testing.T) {
+	s, err := Parse([]byte(rules))
+	assert.NoError(t, err)
+
+	r, target, err := s.Match("msgproxy.1.21", msg(t, `{"status":"1","called":"15201164261","trans_called":"7777"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "missed", r.Name)
+	assert.Equal(t, "15201164261", target)
+
+	r, target, err = s.Match("msgproxy.1.21", msg(t, `{"status":"5","called":"15201164261","trans_called":"13800138000"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "trans", r.Name)
+	assert.Equal(t, "13800138000", target)
+
+	_, target, err = s.Match("msgproxy.2.10", msg(t, `{"call_sta":2,"user_num":"13800138000"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "13800138000", target)
+
+	_, _, err = s.Match("msgproxy.1.21", msg(t, `{"status":"8","called":"15201164261"}`))
+	assert.Equal(t, ErrNoMatch, err)
+
+	_, _, err = s.Match("msgproxy.1.21", msg(t, `{"status":"1"}`))
+	assert.Equal(t, ErrNoTarget, err)
+
+	_, _, err = s.Match("msgproxy.1.22", msg(t, `{"status":"1"}`))
+	assert.Equal(t, ErrNoRule, err)
+}
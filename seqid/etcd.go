@@ -0,0 +1,149 @@
+package seqid
+
+import (
+	"context"
+	"fmt"
+	log "github.com/alecthomas/log4go"
+	"github.com/coreos/etcd/clientv3"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//etcdTimeout bounds each etcd request
+var etcdTimeout = 3 * time.Second
+
+//Lease is a node claimed in etcd, the key dir/<node> lives as long as
+//the lease is kept alive
+type Lease struct {
+	client *clientv3.Client
+	dir    string
+	ttl    time.Duration
+	id     clientv3.LeaseID
+	node   int
+	value  string
+}
+
+//Claim claims the lowest free node under dir with a lease of ttl
+func Claim(endpoints []string, dir string, ttl time.Duration) (*Lease, error) {
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	l := &Lease{client: c, dir: dir, ttl: ttl, node: -1, value: host + ":" + strconv.Itoa(os.Getpid())}
+	if err = l.claim(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+//Node returns the node claimed
+func (l *Lease) Node() int {
+	return l.node
+}
+
+//claim grants a lease and puts it on a free node, the node held before
+//is tried first
+func (l *Lease) claim() error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	resp, err := l.client.Get(ctx, l.dir+"/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+	taken := make(map[int]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if n, err := strconv.Atoi(strings.TrimPrefix(string(kv.Key), l.dir+"/")); err == nil {
+			taken[n] = true
+		}
+	}
+	lease, err := l.client.Grant(ctx, int64(l.ttl/time.Second)+1)
+	if err != nil {
+		return err
+	}
+	try := func(n int) (bool, error) {
+		key := l.dir + "/" + strconv.Itoa(n)
+		r, err := l.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, l.value, clientv3.WithLease(lease.ID))).
+			Commit()
+		if err != nil {
+			return false, err
+		}
+		return r.Succeeded, nil
+	}
+	if l.node >= 0 && !taken[l.node] {
+		if ok, err := try(l.node); err != nil || ok {
+			if ok {
+				l.id = lease.ID
+			}
+			return err
+		}
+	}
+	for n := 0; n <= MaxNode; n++ {
+		if taken[n] {
+			continue
+		}
+		ok, err := try(n)
+		if err != nil {
+			return err
+		}
+		if ok {
+			l.id, l.node = lease.ID, n
+			return nil
+		}
+	}
+	l.client.Revoke(ctx, lease.ID)
+	return fmt.Errorf("seqid: no free node under %s", l.dir)
+}
+
+//Keep keeps the lease alive until done is closed. When the lease is lost
+//a node is claimed anew and handed to set, which must stop using the old
+//one, ie: SetNode.
+func (l *Lease) Keep(set func(node int) error, done <-chan struct{}) {
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := l.client.KeepAlive(ctx, l.id)
+		if err == nil {
+			for alive := true; alive; {
+				select {
+				case _, alive = <-ch:
+				case <-done:
+					cancel()
+					return
+				}
+			}
+		}
+		cancel()
+		log.Error("seqid node %d lease lost, %v", l.node, err)
+		for {
+			if err = l.claim(); err == nil {
+				break
+			}
+			log.Error("seqid claim, %s", err.Error())
+			select {
+			case <-time.After(time.Second):
+			case <-done:
+				return
+			}
+		}
+		if err = set(l.node); err != nil {
+			log.Error(err)
+		}
+		log.Info("seqid node %d claimed", l.node)
+	}
+}
+
+//Close revokes the lease, freeing the node
+func (l *Lease) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	l.client.Revoke(ctx, l.id)
+	return l.client.Close()
+}
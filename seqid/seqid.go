@@ -0,0 +1,109 @@
+package seqid
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	//MaxNode is the largest node, instances sending at once need distinct
+	//nodes
+	MaxNode = 9999
+	//MaxSeq is the largest sequence within a millisecond, more ids borrow
+	//the next millisecond
+	MaxSeq = 9999
+	//Len is the length of every id
+	Len = len(layout) + 3 + 4 + 4
+
+	layout = "20060102150405"
+)
+
+//Generator makes ids of the utc time in milliseconds, the node and a
+//sequence within the millisecond, ie: 20261017083015123 0007 0001 without
+//the spaces. Ids of a generator never repeat, even if the clock steps
+//back, and those of generators with distinct nodes never collide.
+type Generator struct {
+	lock sync.Mutex
+	node int
+	last int64 //millisecond of the last id
+	seq  int
+	now  func() time.Time
+}
+
+//New creates a Generator for node
+func New(node int) (*Generator, error) {
+	if err := check(node); err != nil {
+		return nil, err
+	}
+	return &Generator{node: node, seq: -1, now: time.Now}, nil
+}
+
+func check(node int) error {
+	if node < 0 || node > MaxNode {
+		return fmt.Errorf("seqid node %d: want 0-%d", node, MaxNode)
+	}
+	return nil
+}
+
+//Next returns a new id
+func (g *Generator) Next() string {
+	g.lock.Lock()
+	ms := g.now().UnixNano() / int64(time.Millisecond)
+	if ms > g.last {
+		g.last, g.seq = ms, 0
+	} else if g.seq++; g.seq > MaxSeq {
+		//the clock stepped back or the millisecond is used up
+		g.last, g.seq = g.last+1, 0
+	}
+	ms, node, seq := g.last, g.node, g.seq
+	g.lock.Unlock()
+
+	t := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	b := make([]byte, 0, Len)
+	b = t.AppendFormat(b, layout)
+	b = pad(b, ms%1000, 3)
+	b = pad(b, int64(node), 4)
+	return string(pad(b, int64(seq), 4))
+}
+
+//Node returns the node of g
+func (g *Generator) Node() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.node
+}
+
+//SetNode changes the node of g, ie: after claiming another one
+func (g *Generator) SetNode(node int) error {
+	if err := check(node); err != nil {
+		return err
+	}
+	g.lock.Lock()
+	g.node = node
+	g.lock.Unlock()
+	return nil
+}
+
+//pad appends v zero padded to width digits
+func pad(b []byte, v int64, width int) []byte {
+	s := strconv.FormatInt(v, 10)
+	for i := len(s); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
+
+//std is the generator of the providers, node 0 until SetNode
+var std, _ = New(0)
+
+//Next returns a new id of the standard generator
+func Next() string {
+	return std.Next()
+}
+
+//SetNode sets the node of the standard generator
+func SetNode(node int) error {
+	return std.SetNode(node)
+}
@@ -0,0 +1,77 @@
+package seqid
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	now := time.Date(2026, 10, 17, 8, 30, 15, 0, time.UTC)
+	g, err := New(7)
+	assert.NoError(t, err)
+	g.now = func() time.Time { return now }
+
+	assert.Equal(t, "20261017083015000"+"0007"+"0000", g.Next())
+	assert.Equal(t, "20261017083015000"+"0007"+"0001", g.Next())
+	now = now.Add(123 * time.Millisecond)
+	assert.Equal(t, "20261017083015123"+"0007"+"0000", g.Next())
+
+	//the clock steps back
+	now = now.Add(-time.Second)
+	assert.Equal(t, "20261017083015123"+"0007"+"0001", g.Next())
+
+	//the millisecond used up
+	g.seq = MaxSeq
+	assert.Equal(t, "20261017083015124"+"0007"+"0000", g.Next())
+
+	assert.NoError(t, g.SetNode(MaxNode))
+	assert.Equal(t, "20261017083015124"+"9999"+"0001", g.Next())
+	assert.Equal(t, Len, len(g.Next()))
+
+	_, err = New(-1)
+	assert.Error(t, err)
+	assert.Error(t, g.SetNode(MaxNode+1))
+	assert.Equal(t, MaxNode, g.Node())
+}
+
+//TestUnique draws millions of ids from generators of two nodes at once
+func TestUnique(t *testing.T) {
+	const workers, each = 8, 250000
+	if testing.Short() {
+		t.Skip("millions of ids")
+	}
+	a, _ := New(1)
+	b, _ := New(2)
+	ids := make(chan [Len]byte, 4096)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		g := a
+		if i%2 == 1 {
+			g = b
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				var id [Len]byte
+				copy(id[:], g.Next())
+				ids <- id
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(ids)
+	}()
+
+	seen := make(map[[Len]byte]struct{}, workers*each)
+	for id := range ids {
+		if _, ok := seen[id]; ok {
+			t.Fatalf("duplicate id %s", id[:])
+		}
+		seen[id] = struct{}{}
+	}
+	assert.Equal(t, workers*each, len(seen))
+}
@@ -0,0 +1,176 @@
+package window
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var days = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+//Window is open on Days from From to To, minutes of the day. A window
+//with To before From spans midnight, it opens on Days.
+type Window struct {
+	Days [7]bool
+	From int
+	To   int
+}
+
+//Schedule is a set of windows in a time zone
+type Schedule struct {
+	Windows  []Window
+	Location *time.Location
+}
+
+//Parse parses windows separated by ';', each is optional days and a time
+//range, ie: "mon-fri 09:00-21:00; sat,sun 10:00-18:00". Days are
+//comma separated names or ranges, every day if omitted. tz is an IANA
+//zone name, local time if empty.
+func Parse(spec, tz string) (*Schedule, error) {
+	s := &Schedule{Location: time.Local}
+	if len(tz) > 0 {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+		s.Location = loc
+	}
+	for _, e := range strings.Split(spec, ";") {
+		f := strings.Fields(e)
+		if len(f) == 0 {
+			continue
+		}
+		var w Window
+		var err error
+		switch len(f) {
+		case 1:
+			for i := range w.Days {
+				w.Days[i] = true
+			}
+		case 2:
+			if w.Days, err = parseDays(f[0]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("window %q: want [days] hh:mm-hh:mm", e)
+		}
+		if w.From, w.To, err = parseRange(f[len(f)-1]); err != nil {
+			return nil, err
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	if len(s.Windows) == 0 {
+		return nil, fmt.Errorf("window %q: empty", spec)
+	}
+	return s, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var set [7]bool
+	for _, d := range strings.Split(strings.ToLower(s), ",") {
+		ends := strings.SplitN(d, "-", 2)
+		from, ok := days[ends[0]]
+		if !ok {
+			return set, fmt.Errorf("window day %q", d)
+		}
+		to := from
+		if len(ends) == 2 {
+			if to, ok = days[ends[1]]; !ok {
+				return set, fmt.Errorf("window day %q", d)
+			}
+		}
+		for i := from; ; i = (i + 1) % 7 {
+			set[i] = true
+			if i == to {
+				break
+			}
+		}
+	}
+	return set, nil
+}
+
+func parseRange(s string) (int, int, error) {
+	ends := strings.SplitN(s, "-", 2)
+	if len(ends) != 2 {
+		return 0, 0, fmt.Errorf("window range %q: want hh:mm-hh:mm", s)
+	}
+	from, err := parseClock(ends[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseClock(ends[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if from == to || from == 24*60 {
+		return 0, 0, fmt.Errorf("window range %q: empty", s)
+	}
+	return from, to, nil
+}
+
+func parseClock(s string) (int, error) {
+	hm := strings.SplitN(s, ":", 2)
+	if len(hm) != 2 {
+		return 0, fmt.Errorf("window time %q: want hh:mm", s)
+	}
+	h, err1 := strconv.Atoi(hm[0])
+	m, err2 := strconv.Atoi(hm[1])
+	if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m > 0) {
+		return 0, fmt.Errorf("window time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+//Open tells whether t is inside a window
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.Location)
+	m := t.Hour()*60 + t.Minute()
+	day, prev := t.Weekday(), (t.Weekday()+6)%7
+	for _, w := range s.Windows {
+		if w.From < w.To {
+			if w.Days[day] && m >= w.From && m < w.To {
+				return true
+			}
+			continue
+		}
+		if (w.Days[day] && m >= w.From) || (w.Days[prev] && m < w.To) {
+			return true
+		}
+	}
+	return false
+}
+
+//Next returns t if it is inside a window, else when the next window
+//opens
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Open(t) {
+		return t
+	}
+	local := t.In(s.Location)
+	var next time.Time
+	for d := 0; d <= 7; d++ {
+		y, mo, dd := local.AddDate(0, 0, d).Date()
+		for _, w := range s.Windows {
+			start := time.Date(y, mo, dd, w.From/60, w.From%60, 0, 0, s.Location)
+			if !start.After(t) || !w.Days[start.Weekday()] {
+				continue
+			}
+			if next.IsZero() || start.Before(next) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
@@ -0,0 +1,63 @@
+package window
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("mon-fri 09:00-21:00; sat,sun 10:00-18:00", "Asia/Shanghai")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(s.Windows))
+	assert.Equal(t, [7]bool{false, true, true, true, true, true, false}, s.Windows[0].Days)
+	assert.Equal(t, [7]bool{true, false, false, false, false, false, true}, s.Windows[1].Days)
+	assert.Equal(t, 9*60, s.Windows[0].From)
+	assert.Equal(t, 21*60, s.Windows[0].To)
+
+	s, err = Parse("fri-mon 22:00-24:00", "")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, false, false, true, true}, s.Windows[0].Days)
+	assert.Equal(t, time.Local, s.Location)
+
+	for _, spec := range []string{"", ";", "09:00", "xyz 09:00-10:00", "09:00-09:00", "25:00-26:00", "09:60-10:00", "a b c", "24:00-01:00"} {
+		_, err = Parse(spec, "")
+		assert.Error(t, err, spec)
+	}
+	_, err = Parse("09:00-10:00", "Nowhere/City")
+	assert.Error(t, err)
+}
+
+func TestOpenNext(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	at := func(day, h, m int) time.Time {
+		//2026-10-12 is a monday
+		return time.Date(2026, 10, 12+day, h, m, 0, 0, loc)
+	}
+	s, err := Parse("mon-fri 09:00-21:00; sat,sun 10:00-18:00", "Asia/Shanghai")
+	assert.NoError(t, err)
+
+	assert.True(t, s.Open(at(0, 9, 0)))
+	assert.False(t, s.Open(at(0, 21, 0)))
+	assert.False(t, s.Open(at(0, 2, 0)))
+	assert.True(t, s.Open(at(5, 10, 0)))
+	assert.False(t, s.Open(at(5, 9, 0)))
+	//the same instant in another zone
+	assert.True(t, s.Open(at(0, 9, 0).UTC()))
+
+	assert.Equal(t, at(0, 12, 0), s.Next(at(0, 12, 0)))
+	assert.Equal(t, at(1, 9, 0), s.Next(at(0, 21, 0)))
+	assert.Equal(t, at(0, 9, 0), s.Next(at(0, 2, 0)))
+	//friday night waits for saturday 10:00
+	assert.True(t, at(5, 10, 0).Equal(s.Next(at(4, 22, 0).UTC())))
+
+	//spanning midnight
+	s, err = Parse("fri 22:00-02:00", "Asia/Shanghai")
+	assert.NoError(t, err)
+	assert.True(t, s.Open(at(4, 23, 0)))
+	assert.True(t, s.Open(at(5, 1, 0)))
+	assert.False(t, s.Open(at(5, 2, 0)))
+	assert.False(t, s.Open(at(3, 23, 0)))
+	assert.Equal(t, at(4, 22, 0), s.Next(at(5, 3, 0).AddDate(0, 0, -7)))
+	assert.Equal(t, at(11, 22, 0), s.Next(at(5, 3, 0)))
+}